@@ -32,13 +32,16 @@ type frameIdx struct {
 }
 
 // Takes a file path/HTTP(S) stream URL and returns Discord audio frames through
-// audioFrameCh. After audioFrameCh is closed, errCh can be read to get any
-// potential error. Will cleanly kill ffmpeg if a struct{} is sent through
-// killCh (IMPORTANT: only send the kill signal ONCE: there is a chance that
-// this goroutine exits just before you send a kill signal; this will be
-// absorbed by the channel buffer, but your program might get stuck if you try
-// to send two kill signals to a dead stream).
-func StreamToDiscordOpus(ffmpegPath, input string, stdin io.Reader, seekSeconds float64, playbackSpeed float64, inetOnly bool) (audioFrameCh <-chan []byte, errCh <-chan error, killCh chan<- struct{}) {
+// audioFrameCh. Inputs which already are Opus (in WebM/Matroska or Ogg) are
+// passed through without transcoding where possible; anything else goes
+// through ffmpeg. HTTP(S) inputs are downloaded through proxy unless it's
+// empty (ffmpeg only supports HTTP proxies). After audioFrameCh is closed,
+// errCh can be read to get any potential error. Will cleanly kill ffmpeg if a
+// struct{} is sent through killCh (IMPORTANT: only send the kill signal ONCE:
+// there is a chance that this goroutine exits just before you send a kill
+// signal; this will be absorbed by the channel buffer, but your program might
+// get stuck if you try to send two kill signals to a dead stream).
+func StreamToDiscordOpus(ffmpegPath, input, proxy string, stdin io.Reader, seekSeconds float64, playbackSpeed float64, inetOnly bool) (audioFrameCh <-chan []byte, errCh <-chan error, killCh chan<- struct{}) {
 	out := make(chan []byte, BufferLength*FramesPerSecond)
 	errch := make(chan error, 1)
 	killch := make(chan struct{}, 1)
@@ -52,116 +55,141 @@ func StreamToDiscordOpus(ffmpegPath, input string, stdin io.Reader, seekSeconds
 			return
 		}
 
-		// Set ffmpeg options
-		var cmdOpts []string
-		cmdOpts = append(cmdOpts,
-			"-vn", // no video
-			"-sn", // no subs
-			"-dn") // no data encoding
-		if seekSeconds != 0.0 {
-			cmdOpts = append(cmdOpts,
-				"-accurate_seek",
-				"-ss", strconv.FormatFloat(seekSeconds, 'f', 5, 64)) // seek duration
+		// Seeking and changing the speed require decoding the audio
+		if seekSeconds == 0.0 && playbackSpeed == 1.0 {
+			var nFrames int
+			var err error
+			nFrames, stdin, err = passthroughToDiscordOpus(input, proxy, stdin, out, killch)
+			if err != ErrPassthroughUnsupported {
+				if err != nil {
+					errch <- err
+				}
+				return
+			}
+			// Continue wherever passthrough had to stop
+			seekSeconds = float64(nFrames) * FrameDuration
+			fmt.Println("Unable to pass through audio, transcoding")
 		}
+
+		transcodeToDiscordOpus(ffmpegPath, input, proxy, stdin, seekSeconds, playbackSpeed, out, errch, killch)
+	}()
+
+	return out, errch, killch
+}
+
+// Transcodes the input using ffmpeg; see StreamToDiscordOpus.
+func transcodeToDiscordOpus(ffmpegPath, input, proxy string, stdin io.Reader, seekSeconds float64, playbackSpeed float64, out chan<- []byte, errch chan<- error, killch <-chan struct{}) {
+	// Set ffmpeg options
+	var cmdOpts []string
+	cmdOpts = append(cmdOpts,
+		"-vn", // no video
+		"-sn", // no subs
+		"-dn") // no data encoding
+	if seekSeconds != 0.0 {
 		cmdOpts = append(cmdOpts,
-			"-i", input)
-		if playbackSpeed != 1.0 {
-			cmdOpts = append(cmdOpts,
-				"-filter:a", "atempo="+strconv.FormatFloat(playbackSpeed, 'f', 5, 64)) // playback speed
-		}
+			"-accurate_seek",
+			"-ss", strconv.FormatFloat(seekSeconds, 'f', 5, 64)) // seek duration
+	}
+	if proxy != "" && (strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")) {
 		cmdOpts = append(cmdOpts,
-			"-ab", strconv.Itoa(BitRate), // audio bit rate
-			"-ac", strconv.Itoa(Channels), // audio channels
-			"-frame_size", strconv.Itoa(int(FrameDuration*1000)), // frame size (in ms)
-			"-f", "opus", // output OPUS audio
-			"pipe:1") // output to stdout
-
-		// Prepare ffmpeg command
-		cmd := exec.Command(ffmpegPath, cmdOpts...)
-		if stdin != nil {
-			cmd.Stdin = stdin
-		}
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			errch <- err
-			return
-		}
+			"-http_proxy", proxy)
+	}
+	cmdOpts = append(cmdOpts,
+		"-i", input)
+	if playbackSpeed != 1.0 {
+		cmdOpts = append(cmdOpts,
+			"-filter:a", "atempo="+strconv.FormatFloat(playbackSpeed, 'f', 5, 64)) // playback speed
+	}
+	cmdOpts = append(cmdOpts,
+		"-ab", strconv.Itoa(BitRate), // audio bit rate
+		"-ac", strconv.Itoa(Channels), // audio channels
+		"-frame_size", strconv.Itoa(int(FrameDuration*1000)), // frame size (in ms)
+		"-f", "opus", // output OPUS audio
+		"pipe:1") // output to stdout
+
+	// Prepare ffmpeg command
+	cmd := exec.Command(ffmpegPath, cmdOpts...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		errch <- err
+		return
+	}
+
+	// Start ffmpeg
+	if err := cmd.Start(); err != nil {
+		errch <- err
+		return
+	}
+
+	// We want to let our main loop know if ffmpeg is done
+	donech := make(chan error)
+	go func() {
+		donech <- cmd.Wait()
+	}()
 
-		// Start ffmpeg
-		if err := cmd.Start(); err != nil {
-			errch <- err
-			return
-		}
+	// Ogg decoder
+	dec := newOggDecoder(stdout)
+	var segDec *oggSegmentDecoder
+	startSegDec := false
 
-		// We want to let our main loop know if ffmpeg is done
-		donech := make(chan error)
-		go func() {
-			donech <- cmd.Wait()
-		}()
-
-		// Ogg decoder
-		dec := newOggDecoder(stdout)
-		var segDec *oggSegmentDecoder
-		startSegDec := false
-
-		// Avoid dropping frames
-		wantNewFrame := true
-
-		// Main opus encoder loop
-		for {
-			var frame []byte
-
-			for wantNewFrame {
-				if startSegDec && segDec.More() {
-					frame = make([]byte, segDec.SegmentSize())
-					if err := segDec.ReadSegment(frame); err != nil {
-						errch <- err
-						return
-					}
-					wantNewFrame = false
-				} else if dec.More() {
-					var err error
-					var hdr oggPageHeader
-					hdr, segDec, err = dec.Page()
-					if err != nil {
-						errch <- err
-						return
-					}
-					if hdr.GranulePosition != 0 {
-						startSegDec = true
-					}
-				} else {
-					out = nil
-					break
-				}
-			}
+	// Avoid dropping frames
+	wantNewFrame := true
+
+	// Main opus encoder loop
+	for {
+		var frame []byte
 
-			// Channel IO
-			select {
-			case err := <-donech:
-				fmt.Println("Audio done, waiting for read to finish")
+		for wantNewFrame {
+			if startSegDec && segDec.More() {
+				frame = make([]byte, segDec.SegmentSize())
+				if err := segDec.ReadSegment(frame); err != nil {
+					errch <- err
+					return
+				}
+				wantNewFrame = false
+			} else if dec.More() {
+				var err error
+				var hdr oggPageHeader
+				hdr, segDec, err = dec.Page()
 				if err != nil {
-					// Send error and exit
 					errch <- err
 					return
 				}
-				// Process exited normally, wait until all samples are read
-				// before closing the channels
-				for len(out) != 0 {
-					time.Sleep(20 * time.Millisecond)
+				if hdr.GranulePosition != 0 {
+					startSegDec = true
 				}
-				fmt.Println("Audio read finished")
-				return
-			case <-killch:
-				// Process was killed by user
-				cmd.Process.Signal(os.Interrupt)
-				return
-			case out <- frame:
-				// Output is ready to receive a new frame
-				wantNewFrame = true
+			} else {
+				out = nil
+				break
 			}
 		}
-	}()
 
-	return out, errch, killch
+		// Channel IO
+		select {
+		case err := <-donech:
+			fmt.Println("Audio done, waiting for read to finish")
+			if err != nil {
+				// Send error and exit
+				errch <- err
+				return
+			}
+			// Process exited normally, wait until all samples are read
+			// before closing the channels
+			for len(out) != 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			fmt.Println("Audio read finished")
+			return
+		case <-killch:
+			// Process was killed by user
+			cmd.Process.Signal(os.Interrupt)
+			return
+		case out <- frame:
+			// Output is ready to receive a new frame
+			wantNewFrame = true
+		}
+	}
 }
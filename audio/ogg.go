@@ -194,7 +194,9 @@ func (d *oggDecoder) Page() (hdr oggPageHeader, sd *oggSegmentDecoder, err error
 
 	// Read the sizes of all page segments
 	segsizes := make([]byte, hdr.NumSegments)
-	sd.r.Read(segsizes)
+	if _, err = io.ReadFull(sd.r, segsizes); err != nil {
+		return
+	}
 
 	// Whether to add to the last segment size: Whenever a segment length is
 	// specified as being 255, that means the next segment should be appended
@@ -209,6 +211,17 @@ func (d *oggDecoder) Page() (hdr oggPageHeader, sd *oggSegmentDecoder, err error
 		}
 		add = s == 255
 	}
+	// A packet ending with a 255 segment continues on the next page
+	sd.continued = add
+
+	if len(sd.fullSegsizes) == 0 {
+		// Nothing to read, so check the checksum right away
+		sd.done = true
+		if sd.sum.sum != sd.givenSum {
+			err = ErrOggInvalidChecksum
+			return
+		}
+	}
 
 	if hdr.HeaderType == FHeaderTypeEOS {
 		d.done = true
@@ -225,6 +238,7 @@ type oggSegmentDecoder struct {
 	fullSegsizes []int
 	i            int // segment index
 	done         bool
+	continued    bool // whether the last segment continues on the next page
 }
 
 func (d *oggSegmentDecoder) More() bool {
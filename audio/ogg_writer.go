@@ -0,0 +1,200 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+)
+
+var (
+	ErrOggWriterClosed = errors.New("ogg: writer already closed")
+)
+
+const (
+	// Pages are flushed after this many packets even if they could hold more,
+	// so that files being written can be played back without too much lag.
+	oggOpusPacketsPerPage = FramesPerSecond
+	// Samples the decoder has to discard at the beginning of the stream. The
+	// packets come from libopus (either through ffmpeg or straight from the
+	// source), whose encoder delay is 312 samples at 48kHz. Any other
+	// encoder's delay is close enough not to be noticeable.
+	oggOpusPreSkip = 312
+)
+
+// An oggEncoder writes packets into Ogg pages according to rfc3533
+// (https://www.xiph.org/ogg/doc/rfc3533.txt).
+type oggEncoder struct {
+	w       io.Writer
+	serial  uint32
+	seq     uint32
+	segs    []byte // segment table of the current page
+	data    bytes.Buffer
+	packets int
+}
+
+func newOggEncoder(w io.Writer, serial uint32) *oggEncoder {
+	return &oggEncoder{
+		w:      w,
+		serial: serial,
+	}
+}
+
+// Reports whether a packet of the given size still fits into the current page.
+func (e *oggEncoder) fits(packetSize int) bool {
+	return len(e.segs)+packetSize/maxSegmentSize+1 <= maxSegments
+}
+
+// Adds a packet to the current page. The caller has to make sure it fits.
+func (e *oggEncoder) addPacket(packet []byte) {
+	// A packet is split into segments of 255 bytes, terminated by a segment
+	// shorter than 255 bytes (which may be empty)
+	n := len(packet)
+	for ; n >= maxSegmentSize; n -= maxSegmentSize {
+		e.segs = append(e.segs, maxSegmentSize)
+	}
+	e.segs = append(e.segs, uint8(n))
+	e.data.Write(packet)
+	e.packets++
+}
+
+// Writes out the current page. The granule position is the one of the last
+// packet completed on the page.
+func (e *oggEncoder) flush(headerType uint8, granulePos uint64) error {
+	hdr := oggPageHeader{
+		MagicNumber:        [4]uint8{'O', 'g', 'g', 'S'},
+		Version:            0,
+		HeaderType:         headerType,
+		GranulePosition:    granulePos,
+		BitstreamSerialNum: e.serial,
+		PageSequenceNum:    e.seq,
+		Checksum:           0,
+		NumSegments:        uint8(len(e.segs)),
+	}
+
+	// The checksum is calculated over the whole page with the checksum
+	// field set to 0
+	sum := &crc32Writer{}
+	binary.Write(sum, binary.LittleEndian, hdr)
+	sum.Write(e.segs)
+	sum.Write(e.data.Bytes())
+	hdr.Checksum = sum.sum
+
+	if err := binary.Write(e.w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.segs); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.data.Bytes()); err != nil {
+		return err
+	}
+
+	e.seq++
+	e.segs = e.segs[:0]
+	e.data.Reset()
+	e.packets = 0
+	return nil
+}
+
+// An OggOpusWriter muxes Opus packets (such as the frames returned by
+// StreamToDiscordOpus) into an Ogg/Opus stream according to rfc7845
+// (https://www.rfc-editor.org/rfc/rfc7845). The headers are written
+// along with the first packet, since they depend on its channel count.
+type OggOpusWriter struct {
+	enc        *oggEncoder
+	granulePos uint64
+	started    bool
+	closed     bool
+}
+
+func NewOggOpusWriter(w io.Writer) *OggOpusWriter {
+	return &OggOpusWriter{
+		enc: newOggEncoder(w, rand.Uint32()),
+	}
+}
+
+func (w *OggOpusWriter) writeHeaders(channels uint8) error {
+	// Identification header (must be on its own page)
+	head := new(bytes.Buffer)
+	head.WriteString("OpusHead")
+	binary.Write(head, binary.LittleEndian, struct {
+		Version         uint8
+		Channels        uint8
+		PreSkip         uint16
+		InputSampleRate uint32
+		OutputGain      int16
+		MappingFamily   uint8
+	}{
+		Version:         1,
+		Channels:        channels,
+		PreSkip:         oggOpusPreSkip,
+		InputSampleRate: SampleRate,
+		OutputGain:      0,
+		MappingFamily:   0,
+	})
+	w.enc.addPacket(head.Bytes())
+	if err := w.enc.flush(FHeaderTypeBOS, 0); err != nil {
+		return err
+	}
+
+	// Comment header (must end its page as well)
+	vendor := "dischord"
+	tags := new(bytes.Buffer)
+	tags.WriteString("OpusTags")
+	binary.Write(tags, binary.LittleEndian, uint32(len(vendor)))
+	tags.WriteString(vendor)
+	binary.Write(tags, binary.LittleEndian, uint32(0)) // no user comments
+	w.enc.addPacket(tags.Bytes())
+	if err := w.enc.flush(0, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Writes a single Opus packet.
+func (w *OggOpusWriter) WritePacket(packet []byte) error {
+	if w.closed {
+		return ErrOggWriterClosed
+	}
+	samples, err := opusPacketSamples(packet)
+	if err != nil {
+		return err
+	}
+
+	if !w.started {
+		channels := uint8(1)
+		if opusPacketStereo(packet) {
+			channels = 2
+		}
+		if err := w.writeHeaders(channels); err != nil {
+			return err
+		}
+		w.started = true
+	}
+
+	// Pages are only written out once the next packet comes in, so there's
+	// always something left for the final page
+	if w.enc.packets >= oggOpusPacketsPerPage || !w.enc.fits(len(packet)) {
+		if err := w.enc.flush(0, w.granulePos); err != nil {
+			return err
+		}
+	}
+	w.enc.addPacket(packet)
+	w.granulePos += uint64(samples)
+	return nil
+}
+
+// Writes the final page. Does not close the underlying writer.
+func (w *OggOpusWriter) Close() error {
+	if w.closed {
+		return ErrOggWriterClosed
+	}
+	w.closed = true
+	if !w.started {
+		// Nothing was ever written, so there's no stream to end
+		return nil
+	}
+	return w.enc.flush(FHeaderTypeEOS, w.granulePos)
+}
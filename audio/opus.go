@@ -0,0 +1,258 @@
+package audio
+
+import (
+	"errors"
+)
+
+var (
+	ErrOpusInvalidPacket     = errors.New("opus: invalid packet")
+	ErrOpusCannotRepacketize = errors.New("opus: packet cannot be split into 20ms frames")
+)
+
+// Frame durations in 48kHz samples of each TOC configuration number (see
+// rfc6716, section 3.1).
+var opusConfigFrameSize = [32]int{
+	480, 960, 1920, 2880, // SILK NB
+	480, 960, 1920, 2880, // SILK MB
+	480, 960, 1920, 2880, // SILK WB
+	480, 960, // Hybrid SWB
+	480, 960, // Hybrid FB
+	120, 240, 480, 960, // CELT NB
+	120, 240, 480, 960, // CELT WB
+	120, 240, 480, 960, // CELT SWB
+	120, 240, 480, 960, // CELT FB
+}
+
+// Returns the number of frames contained in an Opus packet.
+func opusPacketFrames(packet []byte) (int, error) {
+	if len(packet) < 1 {
+		return 0, ErrOpusInvalidPacket
+	}
+	switch packet[0] & 0x3 {
+	case 0:
+		return 1, nil
+	case 1, 2:
+		return 2, nil
+	default:
+		if len(packet) < 2 {
+			return 0, ErrOpusInvalidPacket
+		}
+		return int(packet[1] & 0x3f), nil
+	}
+}
+
+// Returns the duration of an Opus packet in 48kHz samples.
+func opusPacketSamples(packet []byte) (int, error) {
+	n, err := opusPacketFrames(packet)
+	if err != nil {
+		return 0, err
+	}
+	return n * opusConfigFrameSize[packet[0]>>3], nil
+}
+
+// Reports whether an Opus packet is encoded in stereo.
+func opusPacketStereo(packet []byte) bool {
+	return len(packet) > 0 && packet[0]&0x4 != 0
+}
+
+// Returns the TOC configuration number (frame duration and mode) of an Opus
+// packet.
+func opusPacketConfig(packet []byte) int {
+	return int(packet[0] >> 3)
+}
+
+// Reads a frame length as coded in Opus packets (see rfc6716, section 3.2.1)
+// and returns it along with the number of bytes it took up.
+func opusReadFrameLength(b []byte) (length int, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, ErrOpusInvalidPacket
+	}
+	if b[0] < 252 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 2 {
+		return 0, 0, ErrOpusInvalidPacket
+	}
+	return int(b[1])*4 + int(b[0]), 2, nil
+}
+
+func opusAppendFrameLength(b []byte, length int) []byte {
+	if length < 252 {
+		return append(b, uint8(length))
+	}
+	first := 252 + length&0x3
+	return append(b, uint8(first), uint8((length-first)/4))
+}
+
+// Splits an Opus packet into its individual frames (see rfc6716, section
+// 3.2). The returned frames point into packet.
+func opusPacketSplit(packet []byte) ([][]byte, error) {
+	if len(packet) < 1 {
+		return nil, ErrOpusInvalidPacket
+	}
+	data := packet[1:]
+	switch packet[0] & 0x3 {
+	case 0:
+		return [][]byte{data}, nil
+	case 1:
+		if len(data)%2 != 0 {
+			return nil, ErrOpusInvalidPacket
+		}
+		return [][]byte{data[:len(data)/2], data[len(data)/2:]}, nil
+	case 2:
+		l, n, err := opusReadFrameLength(data)
+		if err != nil {
+			return nil, err
+		}
+		data = data[n:]
+		if l > len(data) {
+			return nil, ErrOpusInvalidPacket
+		}
+		return [][]byte{data[:l], data[l:]}, nil
+	default:
+		if len(data) < 1 {
+			return nil, ErrOpusInvalidPacket
+		}
+		vbr := data[0]&0x80 != 0
+		padded := data[0]&0x40 != 0
+		count := int(data[0] & 0x3f)
+		data = data[1:]
+		if count == 0 {
+			return nil, ErrOpusInvalidPacket
+		}
+
+		// Padding length: each byte of 255 adds 254 and means another
+		// length byte follows
+		if padded {
+			padding := 0
+			for {
+				if len(data) < 1 {
+					return nil, ErrOpusInvalidPacket
+				}
+				p := int(data[0])
+				data = data[1:]
+				if p == 255 {
+					padding += 254
+				} else {
+					padding += p
+					break
+				}
+			}
+			if padding > len(data) {
+				return nil, ErrOpusInvalidPacket
+			}
+			data = data[:len(data)-padding]
+		}
+
+		lengths := make([]int, count)
+		if vbr {
+			total := 0
+			for i := 0; i < count-1; i++ {
+				l, n, err := opusReadFrameLength(data)
+				if err != nil {
+					return nil, err
+				}
+				data = data[n:]
+				lengths[i] = l
+				total += l
+			}
+			if total > len(data) {
+				return nil, ErrOpusInvalidPacket
+			}
+			lengths[count-1] = len(data) - total
+		} else {
+			if len(data)%count != 0 {
+				return nil, ErrOpusInvalidPacket
+			}
+			for i := range lengths {
+				lengths[i] = len(data) / count
+			}
+		}
+
+		frames := make([][]byte, count)
+		for i, l := range lengths {
+			frames[i] = data[:l]
+			data = data[l:]
+		}
+		return frames, nil
+	}
+}
+
+// Combines frames into a single Opus packet with the given TOC configuration
+// number and channel count; the inverse of opusPacketSplit.
+func opusPacketJoin(config int, stereo bool, frames [][]byte) []byte {
+	toc := uint8(config << 3)
+	if stereo {
+		toc |= 0x4
+	}
+	size := 3
+	for _, f := range frames {
+		size += len(f) + 2
+	}
+	res := make([]byte, 0, size)
+	switch {
+	case len(frames) == 1:
+		res = append(res, toc|0)
+	case len(frames) == 2 && len(frames[0]) == len(frames[1]):
+		res = append(res, toc|1)
+	case len(frames) == 2:
+		res = append(res, toc|2)
+		res = opusAppendFrameLength(res, len(frames[0]))
+	default:
+		res = append(res, toc|3, 0x80|uint8(len(frames))) // VBR, no padding
+		for _, f := range frames[:len(frames)-1] {
+			res = opusAppendFrameLength(res, len(f))
+		}
+	}
+	for _, f := range frames {
+		res = append(res, f...)
+	}
+	return res
+}
+
+// An opusRepacketizer turns Opus packets of any duration into packets of
+// exactly FrameSize samples, as Discord expects them. This works by splitting
+// and joining the frames contained in the packets, so it's only possible if
+// all frames are at most FrameSize samples long and shorter frames line up
+// with the packet boundaries we want.
+type opusRepacketizer struct {
+	pending  [][]byte
+	config   int
+	stereo   bool
+	nSamples int
+}
+
+// Adds a packet and returns any resulting complete packets. The packet's
+// data may be kept until the next call, so it mustn't be modified. Returns
+// ErrOpusCannotRepacketize if the packet can't be repacketized.
+func (r *opusRepacketizer) Add(packet []byte) ([][]byte, error) {
+	frames, err := opusPacketSplit(packet)
+	if err != nil {
+		return nil, err
+	}
+	config := opusPacketConfig(packet)
+	stereo := opusPacketStereo(packet)
+	frameSize := opusConfigFrameSize[config]
+	if frameSize > FrameSize || FrameSize%frameSize != 0 {
+		return nil, ErrOpusCannotRepacketize
+	}
+	if len(r.pending) > 0 && (config != r.config || stereo != r.stereo) {
+		// Frames with a different configuration can't go into the
+		// same packet
+		return nil, ErrOpusCannotRepacketize
+	}
+
+	var res [][]byte
+	for _, f := range frames {
+		r.pending = append(r.pending, f)
+		r.config = config
+		r.stereo = stereo
+		r.nSamples += frameSize
+		if r.nSamples == FrameSize {
+			res = append(res, opusPacketJoin(r.config, r.stereo, r.pending))
+			r.pending = r.pending[:0]
+			r.nSamples = 0
+		}
+	}
+	return res, nil
+}
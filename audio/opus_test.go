@@ -0,0 +1,165 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TOC configuration numbers of CELT fullband packets
+const (
+	testOpusConfig10ms = 30
+	testOpusConfig20ms = 31
+	// 60ms SILK, which can't be split up to 20ms
+	testOpusConfig60ms = 3
+)
+
+func framesEqual(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOpusPacketJoinSplit(t *testing.T) {
+	long := bytes.Repeat([]byte{'x'}, 300)
+
+	for _, test := range []struct {
+		name   string
+		frames [][]byte
+		code   uint8 // expected frame count code of the TOC byte
+	}{
+		{"one frame", [][]byte{[]byte("abc")}, 0},
+		{"two frames of the same size", [][]byte{[]byte("ab"), []byte("cd")}, 1},
+		{"two frames of different sizes", [][]byte{[]byte("abc"), []byte("d")}, 2},
+		{"two-byte frame length", [][]byte{long, []byte("d")}, 2},
+		{"three frames", [][]byte{[]byte("a"), long, []byte("bc")}, 3},
+	} {
+		packet := opusPacketJoin(testOpusConfig10ms, true, test.frames)
+		if packet[0]&0x3 != test.code {
+			t.Errorf("%v: expected code %v but got %v", test.name, test.code, packet[0]&0x3)
+		}
+		if opusPacketConfig(packet) != testOpusConfig10ms || !opusPacketStereo(packet) {
+			t.Errorf("%v: wrong TOC byte %#x", test.name, packet[0])
+		}
+		frames, err := opusPacketSplit(packet)
+		if err != nil {
+			t.Errorf("%v: error: %v", test.name, err)
+		} else if !framesEqual(frames, test.frames) {
+			t.Errorf("%v: expected %q but got %q", test.name, test.frames, frames)
+		}
+	}
+}
+
+func TestOpusPacketSplit(t *testing.T) {
+	toc := uint8(testOpusConfig20ms << 3)
+
+	for _, test := range []struct {
+		name     string
+		packet   []byte
+		expected [][]byte
+		err      error
+	}{
+		{"CBR with padding", []byte{toc | 3, 0x40 | 2, 2, 'a', 'b', 'c', 'd', 0, 0}, [][]byte{[]byte("ab"), []byte("cd")}, nil},
+		{"CBR with padding over 254", append([]byte{toc | 3, 0x40 | 1, 255, 1, 'a'}, make([]byte, 255)...), [][]byte{[]byte("a")}, nil},
+		{"empty", []byte{}, nil, ErrOpusInvalidPacket},
+		{"odd length of equal frames", []byte{toc | 1, 'a', 'b', 'c'}, nil, ErrOpusInvalidPacket},
+		{"frame length too large", []byte{toc | 2, 5, 'a'}, nil, ErrOpusInvalidPacket},
+		{"no frames", []byte{toc | 3, 0}, nil, ErrOpusInvalidPacket},
+		{"CBR not divisible", []byte{toc | 3, 2, 'a', 'b', 'c'}, nil, ErrOpusInvalidPacket},
+		{"padding too large", []byte{toc | 3, 0x40 | 1, 5, 'a'}, nil, ErrOpusInvalidPacket},
+	} {
+		frames, err := opusPacketSplit(test.packet)
+		if err != test.err {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.name, test.err, err)
+		} else if !framesEqual(frames, test.expected) {
+			t.Errorf("%v: expected %q but got %q", test.name, test.expected, frames)
+		}
+	}
+}
+
+func TestOpusRepacketizer(t *testing.T) {
+	packet := func(config int, frames ...string) []byte {
+		var f [][]byte
+		for _, v := range frames {
+			f = append(f, []byte(v))
+		}
+		return opusPacketJoin(config, false, f)
+	}
+
+	for _, test := range []struct {
+		name     string
+		packets  [][]byte
+		expected [][]byte // frames of all resulting packets
+		err      error
+	}{
+		{
+			"20ms packets stay as they are",
+			[][]byte{packet(testOpusConfig20ms, "a"), packet(testOpusConfig20ms, "b")},
+			[][]byte{[]byte("a"), []byte("b")},
+			nil,
+		},
+		{
+			"40ms packets are split",
+			[][]byte{packet(testOpusConfig20ms, "a", "bc")},
+			[][]byte{[]byte("a"), []byte("bc")},
+			nil,
+		},
+		{
+			"10ms packets are joined (the last one waits for another)",
+			[][]byte{packet(testOpusConfig10ms, "a"), packet(testOpusConfig10ms, "bc"), packet(testOpusConfig10ms, "d")},
+			[][]byte{[]byte("a"), []byte("bc")},
+			nil,
+		},
+		{
+			"60ms frames",
+			[][]byte{packet(testOpusConfig60ms, "a")},
+			nil,
+			ErrOpusCannotRepacketize,
+		},
+		{
+			"configuration change within a packet",
+			[][]byte{packet(testOpusConfig10ms, "a"), packet(testOpusConfig20ms, "b")},
+			nil,
+			ErrOpusCannotRepacketize,
+		},
+	} {
+		var rp opusRepacketizer
+		var res [][]byte
+		var err error
+		for _, p := range test.packets {
+			var out [][]byte
+			out, err = rp.Add(p)
+			if err != nil {
+				break
+			}
+			res = append(res, out...)
+		}
+		if err != test.err {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		var frames [][]byte
+		for _, p := range res {
+			if n, err := opusPacketSamples(p); err != nil || n != FrameSize {
+				t.Errorf("%v: expected packets of %v samples but got %v (%v)", test.name, FrameSize, n, err)
+			}
+			f, err := opusPacketSplit(p)
+			if err != nil {
+				t.Fatalf("%v: error: %v", test.name, err)
+			}
+			frames = append(frames, f...)
+		}
+		if !framesEqual(frames, test.expected) {
+			t.Errorf("%v: expected %q but got %q", test.name, test.expected, frames)
+		}
+	}
+}
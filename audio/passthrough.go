@@ -0,0 +1,332 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPassthroughUnsupported = errors.New("input can't be played without transcoding")
+)
+
+type opusPacketReader interface {
+	// Returns the next Opus packet, or io.EOF at the end of the stream.
+	ReadPacket() ([]byte, error)
+}
+
+// An oggOpusReader reads the packets of an Ogg/Opus stream (rfc7845), which,
+// unlike the segments returned by oggSegmentDecoder, may span multiple pages.
+type oggOpusReader struct {
+	dec     *oggDecoder
+	sd      *oggSegmentDecoder
+	serial  uint32
+	partial []byte // beginning of a packet continued on the next page
+	eos     bool
+}
+
+// Reads the stream's headers and makes sure it's actually Opus.
+func newOggOpusReader(r io.Reader) (*oggOpusReader, error) {
+	res := &oggOpusReader{
+		dec: newOggDecoder(r),
+	}
+	hdr, sd, err := res.dec.Page()
+	if err != nil {
+		return nil, err
+	}
+	res.serial = hdr.BitstreamSerialNum
+	res.sd = sd
+
+	// Identification header
+	head, err := res.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return nil, ErrPassthroughUnsupported
+	}
+	// Comment header, which we don't care about
+	if _, err := res.ReadPacket(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (d *oggOpusReader) ReadPacket() ([]byte, error) {
+	for {
+		if d.sd != nil && d.sd.More() {
+			last := d.sd.i == len(d.sd.fullSegsizes)-1
+			buf := make([]byte, d.sd.SegmentSize())
+			if err := d.sd.ReadSegment(buf); err != nil {
+				return nil, err
+			}
+			if d.partial != nil {
+				buf = append(d.partial, buf...)
+				d.partial = nil
+			}
+			if last && d.sd.continued {
+				d.partial = buf
+				continue
+			}
+			return buf, nil
+		}
+
+		if d.eos || !d.dec.More() {
+			return nil, io.EOF
+		}
+		hdr, sd, err := d.dec.Page()
+		if err != nil {
+			if err == io.EOF && d.partial != nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if hdr.BitstreamSerialNum != d.serial {
+			// Some other multiplexed stream
+			d.sd = nil
+			continue
+		}
+		if hdr.HeaderType&FHeaderTypeContinuation == 0 {
+			// Can't continue the packet if the page doesn't
+			d.partial = nil
+		}
+		if hdr.HeaderType&FHeaderTypeEOS != 0 {
+			d.eos = true
+		}
+		d.sd = sd
+	}
+}
+
+// Detects the container format and returns a reader for its Opus packets, or
+// ErrPassthroughUnsupported if there's no Opus to be found.
+func newOpusPacketReader(r *bufio.Reader) (opusPacketReader, error) {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, ErrPassthroughUnsupported
+	}
+	var pr opusPacketReader
+	switch {
+	case string(magic) == "OggS":
+		pr, err = newOggOpusReader(r)
+	case bytes.Equal(magic, webmMagic):
+		pr, err = newWebmOpusReader(r)
+	default:
+		return nil, ErrPassthroughUnsupported
+	}
+	if err != nil {
+		// Anything that doesn't parse is left to ffmpeg
+		return nil, ErrPassthroughUnsupported
+	}
+	return pr, nil
+}
+
+const (
+	// Passthrough gives up on an HTTP input if a single read takes longer
+	// than this
+	passthroughReadTimeout = 30 * time.Second
+)
+
+// Clients for downloading inputs, by proxy.
+var passthroughClients sync.Map // string to *http.Client
+
+// Returns a client using the given proxy (or the environment's proxy if
+// empty). Unlike a client's Timeout, the transport's timeouts don't limit how
+// long the whole response may take to read, which for a long track may well
+// be several minutes.
+func passthroughClient(proxy string) (*http.Client, error) {
+	if c, ok := passthroughClients.Load(proxy); ok {
+		return c.(*http.Client), nil
+	}
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+	c, _ := passthroughClients.LoadOrStore(proxy, &http.Client{Transport: tr})
+	return c.(*http.Client), nil
+}
+
+// A replayReader keeps everything read through it, so the data can be read a
+// second time.
+type replayReader struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+// Returns a reader starting at the beginning of the data again.
+func (r *replayReader) Replay() io.Reader {
+	return io.MultiReader(&r.buf, r.r)
+}
+
+// A timeoutReader calls cancel if a single Read takes longer than timeout.
+type timeoutReader struct {
+	r       io.Reader
+	timeout time.Duration
+	cancel  func()
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	t := time.AfterFunc(r.timeout, r.cancel)
+	defer t.Stop()
+	return r.r.Read(p)
+}
+
+// Sends the Opus packets of a WebM/Matroska or Ogg input through out as
+// Discord frames, without decoding them. Returns ErrPassthroughUnsupported if
+// the input isn't Opus or can't be split into frames of the right size; in
+// that case, nFrames is the number of frames already sent and the returned
+// stdin replaces the given one for any further attempts at reading the input
+// (from the beginning). Stdin is read all over again if it's an io.Seeker and
+// kept in memory otherwise.
+func passthroughToDiscordOpus(input, proxy string, stdin io.Reader, out chan<- []byte, killCh <-chan struct{}) (nFrames int, newStdin io.Reader, err error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	killed := make(chan struct{})
+	watcherDone := make(chan struct{})
+	go func() {
+		defer close(watcherDone)
+		select {
+		case <-killCh:
+			close(killed)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer func() {
+		cancel()
+		<-watcherDone
+		select {
+		case <-killed:
+			// Killed by user, whatever went wrong after that doesn't
+			// matter
+			err = nil
+		default:
+		}
+	}()
+
+	var src io.Reader
+	var rewind func() (io.Reader, error)
+	if stdin != nil {
+		newStdin = stdin
+		if sk, ok := stdin.(io.Seeker); ok {
+			start, err := sk.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return 0, stdin, ErrPassthroughUnsupported
+			}
+			src = stdin
+			rewind = func() (io.Reader, error) {
+				_, err := sk.Seek(start, io.SeekStart)
+				return stdin, err
+			}
+		} else {
+			replay := &replayReader{r: stdin}
+			src = replay
+			rewind = func() (io.Reader, error) {
+				return replay.Replay(), nil
+			}
+		}
+	} else if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+		client, err := passthroughClient(proxy)
+		if err != nil {
+			return 0, nil, ErrPassthroughUnsupported
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", input, nil)
+		if err != nil {
+			return 0, nil, ErrPassthroughUnsupported
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, nil, ErrPassthroughUnsupported
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return 0, nil, ErrPassthroughUnsupported
+		}
+		src = &timeoutReader{r: resp.Body, timeout: passthroughReadTimeout, cancel: cancel}
+	} else {
+		f, err := os.Open(input)
+		if err != nil {
+			return 0, nil, ErrPassthroughUnsupported
+		}
+		defer f.Close()
+		src = f
+	}
+
+	fail := func(err error) (int, io.Reader, error) {
+		if err == ErrPassthroughUnsupported && rewind != nil {
+			r, rerr := rewind()
+			if rerr != nil {
+				return nFrames, nil, rerr
+			}
+			return nFrames, r, err
+		}
+		return nFrames, newStdin, err
+	}
+
+	pr, err := newOpusPacketReader(bufio.NewReader(src))
+	if err != nil {
+		return fail(err)
+	}
+
+	var rp opusRepacketizer
+	for {
+		packet, err := pr.ReadPacket()
+		if err == io.EOF {
+			// Input is done, wait until all frames are read before
+			// returning (any incomplete frame left is dropped)
+			for len(out) != 0 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return nFrames, newStdin, nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				// The input stalled, so leave it to ffmpeg to reconnect
+				// and continue from the current position
+				return fail(ErrPassthroughUnsupported)
+			}
+			return fail(err)
+		}
+
+		frames, err := rp.Add(packet)
+		if err == ErrOpusCannotRepacketize {
+			// Transcoding continues from the current position
+			return fail(ErrPassthroughUnsupported)
+		} else if err != nil {
+			return fail(err)
+		}
+
+		for _, frame := range frames {
+			select {
+			case <-killed:
+				// Killed by user
+				return nFrames, newStdin, nil
+			case out <- frame:
+			}
+			nFrames++
+		}
+	}
+}
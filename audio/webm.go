@@ -0,0 +1,399 @@
+// Minimal WebM/Matroska demuxer, only reading what's needed to get the Opus
+// packets out of a file (https://www.matroska.org/technical/elements.html).
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	ErrWebmInvalidVint     = errors.New("webm: invalid variable size integer")
+	ErrWebmInvalidHeader   = errors.New("webm: invalid EBML header")
+	ErrWebmInvalidBlock    = errors.New("webm: invalid block")
+	ErrWebmElementTooLarge = errors.New("webm: element too large")
+	ErrWebmNoOpusTrack     = errors.New("webm: no Opus audio track found")
+)
+
+// Element IDs (including their length marker bits, as they're usually written).
+const (
+	webmIdEBML        = 0x1a45dfa3
+	webmIdDocType     = 0x4282
+	webmIdSegment     = 0x18538067
+	webmIdTracks      = 0x1654ae6b
+	webmIdTrackEntry  = 0xae
+	webmIdTrackNumber = 0xd7
+	webmIdTrackType   = 0x83
+	webmIdCodecID     = 0x86
+	webmIdCluster     = 0x1f43b675
+	webmIdSimpleBlock = 0xa3
+	webmIdBlockGroup  = 0xa0
+	webmIdBlock       = 0xa1
+)
+
+// Used to recognize WebM/Matroska streams.
+var webmMagic = []byte{0x1a, 0x45, 0xdf, 0xa3}
+
+const (
+	webmTrackTypeAudio = 2
+	// Elements we read into memory as a whole must not be larger than this.
+	webmMaxElementSize = 16 * 1024 * 1024
+	// Size value meaning that the element goes on until its parent ends.
+	webmUnknownSize = -1
+)
+
+// Reads an EBML variable size integer. If keepMarker is set, the length
+// marker bit is kept in the result (which is how element IDs are usually
+// written). An all-ones data value is returned as webmUnknownSize.
+func webmReadVint(r io.ByteReader, keepMarker bool) (int64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	length := 1
+	for mask := uint8(0x80); first&mask == 0; mask >>= 1 {
+		length++
+		if length > 8 {
+			return 0, ErrWebmInvalidVint
+		}
+	}
+	val := uint64(first)
+	if !keepMarker {
+		val &= 0xff >> length
+	}
+	allOnes := val == uint64(0xff>>length)
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		val = val<<8 | uint64(b)
+		allOnes = allOnes && b == 0xff
+	}
+	if !keepMarker && allOnes {
+		return webmUnknownSize, nil
+	}
+	return int64(val), nil
+}
+
+func webmReadElementHeader(r io.ByteReader) (id int64, size int64, err error) {
+	id, err = webmReadVint(r, true)
+	if err != nil {
+		return
+	}
+	size, err = webmReadVint(r, false)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func webmReadUint(b []byte) uint64 {
+	var res uint64
+	for _, v := range b {
+		res = res<<8 | uint64(v)
+	}
+	return res
+}
+
+// Calls fn for each child element in the (fully read) data of a master
+// element.
+func webmForEachChild(data []byte, fn func(id int64, data []byte) error) error {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		id, size, err := webmReadElementHeader(r)
+		if err != nil {
+			return err
+		}
+		if size < 0 || size > int64(r.Len()) {
+			return ErrWebmInvalidHeader
+		}
+		child := data[len(data)-r.Len() : len(data)-r.Len()+int(size)]
+		if err := fn(id, child); err != nil {
+			return err
+		}
+		r.Seek(size, io.SeekCurrent)
+	}
+	return nil
+}
+
+type webmTrack struct {
+	Number  uint64
+	Type    uint64
+	CodecID string
+}
+
+// A webmOpusReader reads the packets of the first Opus audio track in a WebM
+// or Matroska stream.
+type webmOpusReader struct {
+	r       *bufio.Reader
+	track   webmTrack
+	packets [][]byte // already demuxed packets (from laced blocks)
+}
+
+// Reads the stream's headers up until the track information.
+func newWebmOpusReader(r *bufio.Reader) (*webmOpusReader, error) {
+	res := &webmOpusReader{
+		r: r,
+	}
+
+	// EBML header
+	id, size, err := webmReadElementHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != webmIdEBML {
+		return nil, ErrWebmInvalidHeader
+	}
+	hdr, err := res.readElementData(size)
+	if err != nil {
+		return nil, err
+	}
+	var docType string
+	if err := webmForEachChild(hdr, func(id int64, data []byte) error {
+		if id == webmIdDocType {
+			docType = string(data)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if docType != "webm" && docType != "matroska" {
+		return nil, ErrWebmInvalidHeader
+	}
+
+	// Find the track information
+	for {
+		id, size, err := webmReadElementHeader(r)
+		if err != nil {
+			if err == io.EOF {
+				err = ErrWebmNoOpusTrack
+			}
+			return nil, err
+		}
+		switch id {
+		case webmIdSegment:
+			// Look at the children
+		case webmIdCluster:
+			// Tracks have to come before any actual data
+			return nil, ErrWebmNoOpusTrack
+		case webmIdTracks:
+			data, err := res.readElementData(size)
+			if err != nil {
+				return nil, err
+			}
+			found := false
+			if err := webmForEachChild(data, func(id int64, data []byte) error {
+				if id != webmIdTrackEntry || found {
+					return nil
+				}
+				var t webmTrack
+				if err := webmForEachChild(data, func(id int64, data []byte) error {
+					switch id {
+					case webmIdTrackNumber:
+						t.Number = webmReadUint(data)
+					case webmIdTrackType:
+						t.Type = webmReadUint(data)
+					case webmIdCodecID:
+						t.CodecID = string(data)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if t.Type == webmTrackTypeAudio && t.CodecID == "A_OPUS" {
+					res.track = t
+					found = true
+				}
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			if !found {
+				return nil, ErrWebmNoOpusTrack
+			}
+			return res, nil
+		default:
+			if err := res.skipElementData(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *webmOpusReader) readElementData(size int64) ([]byte, error) {
+	if size < 0 || size > webmMaxElementSize {
+		return nil, ErrWebmElementTooLarge
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (d *webmOpusReader) skipElementData(size int64) error {
+	if size < 0 {
+		// We can't know where an element of unknown size ends without
+		// understanding its contents
+		return ErrWebmElementTooLarge
+	}
+	_, err := d.r.Discard(int(size))
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Returns the next Opus packet, or io.EOF at the end of the stream.
+func (d *webmOpusReader) ReadPacket() ([]byte, error) {
+	for len(d.packets) == 0 {
+		id, size, err := webmReadElementHeader(d.r)
+		if err != nil {
+			return nil, err
+		}
+		switch id {
+		case webmIdSegment, webmIdCluster:
+			// Look at the children
+		case webmIdSimpleBlock, webmIdBlockGroup:
+			data, err := d.readElementData(size)
+			if err != nil {
+				return nil, err
+			}
+			if id == webmIdBlockGroup {
+				var block []byte
+				if err := webmForEachChild(data, func(id int64, data []byte) error {
+					if id == webmIdBlock {
+						block = data
+					}
+					return nil
+				}); err != nil {
+					return nil, err
+				}
+				if block == nil {
+					continue
+				}
+				data = block
+			}
+			if err := d.readBlock(data); err != nil {
+				return nil, err
+			}
+		default:
+			if err := d.skipElementData(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	res := d.packets[0]
+	d.packets = d.packets[1:]
+	return res, nil
+}
+
+// Splits a (Simple)Block into its frames, keeping those of our track.
+func (d *webmOpusReader) readBlock(data []byte) error {
+	r := bytes.NewReader(data)
+	track, err := webmReadVint(r, false)
+	if err != nil {
+		return ErrWebmInvalidBlock
+	}
+	if uint64(track) != d.track.Number {
+		return nil
+	}
+	// Skip the 16 bit relative timestamp
+	if _, err := r.Seek(2, io.SeekCurrent); err != nil {
+		return ErrWebmInvalidBlock
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return ErrWebmInvalidBlock
+	}
+
+	lacing := (flags >> 1) & 0x3
+	if lacing == 0 {
+		d.packets = append(d.packets, data[len(data)-r.Len():])
+		return nil
+	}
+
+	// Laced blocks contain multiple frames
+	nFramesMinus1, err := r.ReadByte()
+	if err != nil {
+		return ErrWebmInvalidBlock
+	}
+	n := int(nFramesMinus1) + 1
+	sizes := make([]int64, n)
+	switch lacing {
+	case 1: // Xiph lacing
+		for i := 0; i < n-1; i++ {
+			for {
+				b, err := r.ReadByte()
+				if err != nil {
+					return ErrWebmInvalidBlock
+				}
+				sizes[i] += int64(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+	case 2: // Fixed-size lacing
+		for i := range sizes {
+			sizes[i] = int64(r.Len()) / int64(n)
+		}
+	case 3: // EBML lacing: first size as vint, then signed differences
+		first, err := webmReadVint(r, false)
+		if err != nil || first < 0 {
+			return ErrWebmInvalidBlock
+		}
+		sizes[0] = first
+		for i := 1; i < n-1; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return ErrWebmInvalidBlock
+			}
+			r.UnreadByte()
+			length := 1
+			for mask := uint8(0x80); b&mask == 0 && length <= 8; mask >>= 1 {
+				length++
+			}
+			diff, err := webmReadVint(r, false)
+			if err != nil || length > 8 {
+				return ErrWebmInvalidBlock
+			}
+			// Signed values are stored with a bias of half the range
+			diff -= 1<<(7*length-1) - 1
+			sizes[i] = sizes[i-1] + diff
+		}
+	}
+
+	var total int64
+	for _, s := range sizes[:n-1] {
+		if s < 0 {
+			return ErrWebmInvalidBlock
+		}
+		total += s
+	}
+	if lacing != 2 {
+		sizes[n-1] = int64(r.Len()) - total
+	}
+	if sizes[n-1] < 0 {
+		return ErrWebmInvalidBlock
+	}
+
+	offset := int64(len(data) - r.Len())
+	for _, s := range sizes {
+		if offset+s > int64(len(data)) {
+			return ErrWebmInvalidBlock
+		}
+		d.packets = append(d.packets, data[offset:offset+s])
+		offset += s
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package audio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWebmReadVint(t *testing.T) {
+	for _, test := range []struct {
+		data       []byte
+		keepMarker bool
+		expected   int64
+		err        error
+	}{
+		{[]byte{0x81}, false, 1, nil},
+		{[]byte{0x81}, true, 0x81, nil},
+		{[]byte{0x40, 0x02}, false, 2, nil},
+		{[]byte{0x1a, 0x45, 0xdf, 0xa3}, true, webmIdEBML, nil},
+		// All ones means the size is unknown, no matter the length
+		{[]byte{0xff}, false, webmUnknownSize, nil},
+		{[]byte{0x7f, 0xff}, false, webmUnknownSize, nil},
+		{[]byte{0x01, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, false, webmUnknownSize, nil},
+		// ...but only if it's a size
+		{[]byte{0xff}, true, 0xff, nil},
+		// Not all ones
+		{[]byte{0x7f, 0xfe}, false, 0x3ffe, nil},
+		{[]byte{0x00}, false, 0, ErrWebmInvalidVint},
+		{[]byte{0x40}, false, 0, io.ErrUnexpectedEOF},
+		{[]byte{}, false, 0, io.EOF},
+	} {
+		res, err := webmReadVint(bytes.NewReader(test.data), test.keepMarker)
+		if err != test.err {
+			t.Errorf("%x: expected error '%v' but got '%v'", test.data, test.err, err)
+		} else if res != test.expected {
+			t.Errorf("%x: expected %v but got %v", test.data, test.expected, res)
+		}
+	}
+}
+
+func TestWebmReadBlock(t *testing.T) {
+	// Track number 1, timestamp 0 and the flags, followed by the lacing
+	// header and data
+	block := func(flags uint8, rest ...[]byte) []byte {
+		return append([]byte{0x81, 0x00, 0x00, flags}, bytes.Join(rest, nil)...)
+	}
+	long := bytes.Repeat([]byte{'x'}, 256)
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected []string
+		err      error
+	}{
+		{"no lacing", block(0x00, []byte("abc")), []string{"abc"}, nil},
+		{"Xiph lacing", block(0x02, []byte{2, 2, 1}, []byte("aabcc")), []string{"aa", "b", "cc"}, nil},
+		{"Xiph lacing of a size over 255", block(0x02, []byte{1, 255, 1}, long, []byte("y")), []string{string(long), "y"}, nil},
+		{"fixed-size lacing", block(0x04, []byte{1}, []byte("abcd")), []string{"ab", "cd"}, nil},
+		// The second size is the first minus one, stored as 62 (-1 plus
+		// a bias of 63)
+		{"EBML lacing", block(0x06, []byte{2, 0x83, 0x80 | 62}, []byte("abcdefgh")), []string{"abc", "de", "fgh"}, nil},
+		{"other track", append([]byte{0x82}, block(0x00, []byte("abc"))[1:]...), nil, nil},
+		{"Xiph size too large", block(0x02, []byte{1, 5}, []byte("abc")), nil, ErrWebmInvalidBlock},
+		{"EBML size too large", block(0x06, []byte{1, 0x85}, []byte("abc")), nil, ErrWebmInvalidBlock},
+		{"truncated", []byte{0x81, 0x00}, nil, ErrWebmInvalidBlock},
+	} {
+		d := &webmOpusReader{track: webmTrack{Number: 1}}
+		err := d.readBlock(test.data)
+		if err != test.err {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.name, test.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		var packets []string
+		for _, v := range d.packets {
+			packets = append(packets, string(v))
+		}
+		if len(packets) != len(test.expected) {
+			t.Errorf("%v: expected %q but got %q", test.name, test.expected, packets)
+			continue
+		}
+		for i := range packets {
+			if packets[i] != test.expected[i] {
+				t.Errorf("%v: expected %q but got %q", test.name, test.expected, packets)
+				break
+			}
+		}
+	}
+}
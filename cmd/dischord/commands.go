@@ -0,0 +1,190 @@
+package main
+
+import (
+	dc "github.com/bwmarrin/discordgo"
+
+	"git.nobrain.org/r4/dischord/config"
+
+	"fmt"
+)
+
+type commandSyncResult struct {
+	Added     int
+	Changed   int
+	Removed   int
+	Unchanged int
+}
+
+func (r commandSyncResult) UpToDate() bool {
+	return r.Added == 0 && r.Changed == 0 && r.Removed == 0
+}
+
+func (r commandSyncResult) String() string {
+	return fmt.Sprintf("%v added, %v changed, %v removed, %v unchanged", r.Added, r.Changed, r.Removed, r.Unchanged)
+}
+
+// Makes the commands registered with Discord match cmds, either globally
+// (guildId == "") or for a single guild. All commands are overwritten in bulk,
+// but only if anything actually changed, since Discord rate-limits command
+// registration pretty aggressively.
+func syncCommands(s *dc.Session, guildId string, cmds []*dc.ApplicationCommand) (commandSyncResult, error) {
+	var res commandSyncResult
+
+	appId := s.State.User.ID
+
+	registered, err := s.ApplicationCommands(appId, guildId)
+	if err != nil {
+		return res, err
+	}
+	registeredByName := make(map[string]*dc.ApplicationCommand, len(registered))
+	for _, v := range registered {
+		registeredByName[v.Name] = v
+	}
+
+	for _, v := range cmds {
+		if r, ok := registeredByName[v.Name]; ok {
+			if commandsEqual(v, r) {
+				res.Unchanged++
+			} else {
+				res.Changed++
+			}
+			delete(registeredByName, v.Name)
+		} else {
+			res.Added++
+		}
+	}
+	res.Removed = len(registeredByName)
+
+	if res.UpToDate() {
+		return res, nil
+	}
+
+	if cmds == nil {
+		// Discord doesn't accept null as an empty command list
+		cmds = []*dc.ApplicationCommand{}
+	}
+	if _, err := s.ApplicationCommandBulkOverwrite(appId, guildId, cmds); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// Returns the commands to register globally (key "") and in each of the given
+// guilds. Discord has no way of hiding a global command in a single guild, so
+// commands which are disabled anywhere are registered per guild instead.
+// Guilds which shouldn't have any commands map to nil, so that old
+// registrations are removed.
+func commandTargets(cmds []*dc.ApplicationCommand, cfg config.CommandConfig, guildIds []string) map[string][]*dc.ApplicationCommand {
+	res := make(map[string][]*dc.ApplicationCommand, len(guildIds)+1)
+	res[""] = nil
+	for _, v := range guildIds {
+		res[v] = nil
+	}
+
+	if len(cfg.TestGuildIds) > 0 {
+		for _, v := range cfg.TestGuildIds {
+			res[v] = enabledCommands(cmds, cfg, v)
+		}
+		return res
+	}
+
+	var global, perGuild []*dc.ApplicationCommand
+	for _, v := range cmds {
+		disabled := false
+		for guildId := range cfg.Guilds {
+			if !cfg.Enabled(guildId, v.Name) {
+				disabled = true
+				break
+			}
+		}
+		if disabled {
+			perGuild = append(perGuild, v)
+		} else {
+			global = append(global, v)
+		}
+	}
+	res[""] = global
+	if len(perGuild) > 0 {
+		for _, v := range guildIds {
+			res[v] = enabledCommands(perGuild, cfg, v)
+		}
+	}
+	return res
+}
+
+// Returns the commands which are enabled for the given guild.
+func enabledCommands(cmds []*dc.ApplicationCommand, cfg config.CommandConfig, guildId string) []*dc.ApplicationCommand {
+	var res []*dc.ApplicationCommand
+	for _, v := range cmds {
+		if cfg.Enabled(guildId, v.Name) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// Only compares the fields we actually set; anything else is filled in by
+// Discord and would always differ.
+func commandsEqual(a, b *dc.ApplicationCommand) bool {
+	typ := func(t dc.ApplicationCommandType) dc.ApplicationCommandType {
+		if t == 0 {
+			return dc.ChatApplicationCommand
+		}
+		return t
+	}
+	return typ(a.Type) == typ(b.Type) &&
+		a.Name == b.Name &&
+		a.Description == b.Description &&
+		commandOptionsEqual(a.Options, b.Options)
+}
+
+func commandOptionsEqual(a, b []*dc.ApplicationCommandOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	floatPtrEqual := func(a, b *float64) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return *a == *b
+	}
+	intPtrEqual := func(a, b *int) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return *a == *b
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.Type != y.Type ||
+			x.Name != y.Name ||
+			x.Description != y.Description ||
+			x.Required != y.Required ||
+			x.Autocomplete != y.Autocomplete ||
+			!floatPtrEqual(x.MinValue, y.MinValue) ||
+			x.MaxValue != y.MaxValue ||
+			!intPtrEqual(x.MinLength, y.MinLength) ||
+			x.MaxLength != y.MaxLength ||
+			len(x.Choices) != len(y.Choices) ||
+			len(x.ChannelTypes) != len(y.ChannelTypes) {
+			return false
+		}
+		for j := range x.Choices {
+			// Values are compared as strings because numbers come back
+			// from Discord as float64
+			if x.Choices[j].Name != y.Choices[j].Name ||
+				fmt.Sprint(x.Choices[j].Value) != fmt.Sprint(y.Choices[j].Value) {
+				return false
+			}
+		}
+		for j := range x.ChannelTypes {
+			if x.ChannelTypes[j] != y.ChannelTypes[j] {
+				return false
+			}
+		}
+		if !commandOptionsEqual(x.Options, y.Options) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,13 +3,16 @@ package main
 import (
 	dc "github.com/bwmarrin/discordgo"
 
+	"git.nobrain.org/r4/dischord/audio"
 	"git.nobrain.org/r4/dischord/config"
 	"git.nobrain.org/r4/dischord/extractor"
 	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/match"
 	"git.nobrain.org/r4/dischord/extractor/ytdl"
 	"git.nobrain.org/r4/dischord/player"
 	"git.nobrain.org/r4/dischord/util"
 
+	"context"
 	_ "embed"
 	"errors"
 	"flag"
@@ -22,12 +25,15 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 var copyright bool
 var autoconf bool
 var registerCommands bool
 var unregisterCommands bool
+var repl bool
+var replOutput string
 
 //go:embed bye.opus
 var resByeOpus []byte
@@ -37,6 +43,8 @@ func init() {
 	flag.BoolVar(&autoconf, "autoconf", false, "launch automatic configurator program (overwriting any existing configuration)")
 	flag.BoolVar(&registerCommands, "register_commands", true, "register commands with Discord upon startup")
 	flag.BoolVar(&unregisterCommands, "unregister_commands", false, "unregister registered commands with Discord upon shutdown")
+	flag.BoolVar(&repl, "repl", false, "run without Discord, reading commands from the terminal and writing audio to a file")
+	flag.StringVar(&replOutput, "repl_output", "dischord-repl.opus", "Ogg/Opus output file for -repl mode (- for stdout)")
 }
 
 // A UserError is shown to the user
@@ -46,11 +54,27 @@ type UserError struct {
 
 const (
 	interactionFlags = dc.MessageFlagsEphemeral
+	// Discord discards autocomplete responses after 3 seconds, so there's
+	// no point in searching for any longer than this
+	autocompleteTimeout = 2500 * time.Millisecond
+	// Discord doesn't accept any more than this
+	maxAutocompleteChoices = 25
+	// Time limit for extracting anything added by a command (long playlists
+	// can take a while)
+	extractTimeout = 5 * time.Minute
+	// How often the "Loading playlist" message is updated at most
+	loadingUpdateInterval = 2 * time.Second
+	// Tracks found by searching for their metadata on another site (e.g.
+	// Spotify tracks on YouTube) are flagged as possibly wrong below this
+	lowMatchConfidence = 0.5
 )
 
 var (
 	ErrVoiceNotConnected               = UserError{errors.New("bot is currently not connected to a voice channel")}
 	ErrUnsupportedUrl                  = UserError{errors.New("unsupported URL")}
+	ErrExtractTimeout                  = UserError{errors.New("timed out, please try again later")}
+	ErrAlreadyRecording                = UserError{errors.New("already recording, use `record stop` to finish the current recording")}
+	ErrNotRecording                    = UserError{errors.New("not recording, use `record start` to start a recording")}
 	ErrStartThinkingNotInitialResponse = errors.New("StartThinking() must be the initial response")
 	ErrInvalidAutocompleteCall         = errors.New("invalid autocomplete call")
 )
@@ -62,15 +86,30 @@ type MessageData struct {
 	Embeds     []*dc.MessageEmbed
 }
 
-type MessageWriter struct {
+// A MessageWriter sends the response(s) to a single command invocation.
+type MessageWriter interface {
+	// Signals that the actual response will take a while. Some writers
+	// require this to be the first thing sent.
+	StartThinking() error
+	Message(d *MessageData) error
+	// Replaces the last message sent, e.g. to show progress. Sends a new one
+	// if there's none yet.
+	Update(d *MessageData) error
+}
+
+// An InteractionMessageWriter responds to a slash command interaction.
+type InteractionMessageWriter struct {
 	session     *dc.Session
 	interaction *dc.Interaction
 	first       bool
 	thinking    bool
+	// ID of the last followup message; empty if the last message was the
+	// initial response
+	lastFollowup string
 }
 
-func NewMessageWriter(s *dc.Session, ia *dc.Interaction) *MessageWriter {
-	return &MessageWriter{
+func NewInteractionMessageWriter(s *dc.Session, ia *dc.Interaction) *InteractionMessageWriter {
+	return &InteractionMessageWriter{
 		session:     s,
 		interaction: ia,
 		first:       true,
@@ -78,7 +117,7 @@ func NewMessageWriter(s *dc.Session, ia *dc.Interaction) *MessageWriter {
 	}
 }
 
-func (m *MessageWriter) StartThinking() error {
+func (m *InteractionMessageWriter) StartThinking() error {
 	if !m.first {
 		return ErrStartThinkingNotInitialResponse
 	}
@@ -96,7 +135,7 @@ func (m *MessageWriter) StartThinking() error {
 	return nil
 }
 
-func (m *MessageWriter) Message(d *MessageData) error {
+func (m *InteractionMessageWriter) Message(d *MessageData) error {
 	var err error
 	if m.first {
 		err = m.session.InteractionRespond(m.interaction, &dc.InteractionResponse{
@@ -117,13 +156,17 @@ func (m *MessageWriter) Message(d *MessageData) error {
 			Embeds:     &d.Embeds,
 		})
 	} else {
-		_, err = m.session.FollowupMessageCreate(m.interaction, true, &dc.WebhookParams{
+		var msg *dc.Message
+		msg, err = m.session.FollowupMessageCreate(m.interaction, true, &dc.WebhookParams{
 			Content:    d.Content,
 			Flags:      interactionFlags,
 			Files:      d.Files,
 			Components: d.Components,
 			Embeds:     d.Embeds,
 		})
+		if err == nil {
+			m.lastFollowup = msg.ID
+		}
 	}
 	if err != nil {
 		return err
@@ -133,6 +176,26 @@ func (m *MessageWriter) Message(d *MessageData) error {
 	return nil
 }
 
+func (m *InteractionMessageWriter) Update(d *MessageData) error {
+	if m.first || m.thinking {
+		// Nothing to replace yet
+		return m.Message(d)
+	}
+	edit := &dc.WebhookEdit{
+		Content:    &d.Content,
+		Files:      d.Files,
+		Components: &d.Components,
+		Embeds:     &d.Embeds,
+	}
+	var err error
+	if m.lastFollowup == "" {
+		_, err = m.session.InteractionResponseEdit(m.interaction, edit)
+	} else {
+		_, err = m.session.FollowupMessageEdit(m.interaction, m.lastFollowup, edit)
+	}
+	return err
+}
+
 func main() {
 	flag.Parse()
 
@@ -141,13 +204,14 @@ func main() {
 		return
 	}
 
-	var clients sync.Map // guild ID string to player.Client
+	var clients sync.Map    // guild ID string to player.Client
+	var recordings sync.Map // guild ID string to *recording
 
 	// Load / create configuration file
 	cfgfile := "config.toml"
 	var cfg *config.Config
 	var err error
-	if autoconf || func() bool { cfg, err = config.Load(cfgfile); return err != nil }() {
+	if autoconf || func() bool { cfg, err = config.Load(cfgfile, !repl); return err != nil }() {
 		if err != nil {
 			if os.IsNotExist(err) {
 				fmt.Println("Configuration file not found, launching automatic configurator.")
@@ -177,19 +241,12 @@ func main() {
 		return
 	}
 
-	getClient := func(s *dc.Session, ia *dc.Interaction, create bool) (client player.Client, err error, created bool) {
-		clI, exists := clients.Load(ia.GuildID)
-		if exists {
-			return clI.(player.Client), nil, false
-		}
-
-		if !create {
-			return player.Client{}, ErrVoiceNotConnected, false
-		}
-
+	// Creates a new player client for the guild an interaction came from; may
+	// be replaced to play somewhere else than a voice channel
+	newClient := func(s *dc.Session, ia *dc.Interaction) (player.Client, error) {
 		g, err := s.State.Guild(ia.GuildID)
 		if err != nil {
-			return player.Client{}, err, false
+			return player.Client{}, err
 		}
 
 		voiceChannelId := ""
@@ -201,21 +258,37 @@ func main() {
 		}
 
 		if voiceChannelId == "" {
-			return player.Client{}, UserError{errors.New("bot doesn't know where to join, please enter a voice channel")}, false
+			return player.Client{}, UserError{errors.New("bot doesn't know where to join, please enter a voice channel")}
 		}
 
 		vc, err := s.ChannelVoiceJoin(ia.GuildID, voiceChannelId, false, true)
 		if err != nil {
-			return player.Client{}, err, false
+			return player.Client{}, err
 		}
 
-		cl := player.NewClient(cfg.Extractors, cfg.FfmpegPath, vc.OpusSend, func(e player.EventStreamUpdated) {
+		return player.NewClient(cfg.Extractors, cfg.FfmpegPath, vc.OpusSend, func(e player.EventStreamUpdated) {
 			if err := vc.Speaking(true); err != nil {
 				fmt.Println("Unable to speak:", err)
 			}
 		}, func(e player.EventKilled) {
 			vc.Disconnect()
-		})
+		}), nil
+	}
+
+	getClient := func(s *dc.Session, ia *dc.Interaction, create bool) (client player.Client, err error, created bool) {
+		clI, exists := clients.Load(ia.GuildID)
+		if exists {
+			return clI.(player.Client), nil, false
+		}
+
+		if !create {
+			return player.Client{}, ErrVoiceNotConnected, false
+		}
+
+		cl, err := newClient(s, ia)
+		if err != nil {
+			return player.Client{}, err, false
+		}
 
 		clients.Store(ia.GuildID, cl)
 
@@ -228,6 +301,37 @@ func main() {
 		return cl, nil, true
 	}
 
+	// Detaches and returns the guild's current recording, if any
+	stopRecording := func(cl player.Client, guildId string) (*recording, bool) {
+		recI, exists := recordings.LoadAndDelete(guildId)
+		if !exists {
+			return nil, false
+		}
+		// Once the command has been received, the tap won't be called anymore
+		cl.CmdCh <- player.CmdSetTap(nil)
+		return recI.(*recording), true
+	}
+
+	// Finishes a recording and uploads it
+	sendRecording := func(m MessageWriter, rec *recording) error {
+		defer rec.Remove()
+		file, recErr := rec.Finish()
+		if file == nil {
+			if recErr != nil {
+				return UserError{recErr}
+			}
+			return nil
+		}
+		msg := "Here's your recording"
+		if recErr == ErrRecordingTooLarge {
+			msg += " (cut off at Discord's maximum upload size)"
+		} else if recErr != nil {
+			fmt.Println("Error while recording:", recErr)
+			msg += " (an error occurred while recording, so it may be incomplete)"
+		}
+		return m.Message(&MessageData{Content: msg, Files: []*dc.File{file}})
+	}
+
 	getOptions := func(d *dc.ApplicationCommandInteractionData) map[string]*dc.ApplicationCommandInteractionDataOption {
 		opts := make(map[string]*dc.ApplicationCommandInteractionDataOption, len(d.Options))
 		for _, v := range d.Options {
@@ -254,7 +358,7 @@ func main() {
 				{
 					Type:         dc.ApplicationCommandOptionString,
 					Name:         "url-or-query",
-					Description:  "Video/music/playlist URL or search query to start playing",
+					Description:  "Video/music/playlist URL or search query to start playing (\"sc: ...\" searches SoundCloud)",
 					Required:     false,
 					Autocomplete: true,
 				},
@@ -267,7 +371,7 @@ func main() {
 				{
 					Type:         dc.ApplicationCommandOptionString,
 					Name:         "url-or-query",
-					Description:  "Video/music/playlist URL or search query to add to queue",
+					Description:  "Video/music/playlist URL or search query to add to queue (\"sc: ...\" searches SoundCloud)",
 					Required:     true,
 					Autocomplete: true,
 				},
@@ -293,6 +397,22 @@ func main() {
 			Name:        "dc",
 			Description: "Alias for stop (stop playback and disconnect)",
 		},
+		{
+			Name:        "record",
+			Description: "Record the played audio and upload it as a file",
+			Options: []*dc.ApplicationCommandOption{
+				{
+					Type:        dc.ApplicationCommandOptionSubCommand,
+					Name:        "start",
+					Description: "Start recording",
+				},
+				{
+					Type:        dc.ApplicationCommandOptionSubCommand,
+					Name:        "stop",
+					Description: "Stop recording and upload the result",
+				},
+			},
+		},
 		{
 			Name:        "jump",
 			Description: "Jump to a track by number or name",
@@ -420,33 +540,119 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:        "fix-match",
+			Description: "Play a track found by searching (e.g. from Spotify) from a different video from now on",
+			Options: []*dc.ApplicationCommandOption{
+				{
+					Type:         dc.ApplicationCommandOptionString,
+					Name:         "track",
+					Description:  "Track number or matching string",
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Type:         dc.ApplicationCommandOptionString,
+					Name:         "video",
+					Description:  "Search result or URL of the video to play the track from",
+					Required:     true,
+					Autocomplete: true,
+				},
+			},
+		},
 	}
 
-	addToQueue := func(s *dc.Session, m *MessageWriter, cl player.Client, input string) error {
+	// If play is true, playback starts as soon as the first results are in
+	// the queue.
+	addToQueue := func(s *dc.Session, m MessageWriter, cl player.Client, input string, play bool) error {
 		if err := m.StartThinking(); err != nil {
 			return err
 		}
 
-		data, err := extractor.Extract(cfg.Extractors, input)
-		if err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+		defer cancel()
+
+		// Results are added to the queue as they come in, so long playlists
+		// start playing right away
+		var first extractor.Data
+		// Known even if none of the items are available
+		var playlistTitle string
+		added, unavailable, batches := 0, 0, 0
+		var lastUpdate time.Time
+		err := extractor.ExtractFunc(ctx, cfg.Extractors, input, func(data []extractor.Data) error {
+			if playlistTitle == "" && len(data) > 0 {
+				playlistTitle = data[0].PlaylistTitle
+			}
+			// Deleted or private playlist entries are only counted
+			var playable []extractor.Data
+			for _, d := range data {
+				if d.Unavailable {
+					unavailable++
+				} else {
+					playable = append(playable, d)
+				}
+			}
+			if len(playable) == 0 {
+				return nil
+			}
+			if added == 0 {
+				first = playable[0]
+			}
+			cl.CmdCh <- player.CmdAddBack(playable)
+			if play && added == 0 {
+				cl.CmdCh <- player.CmdPlay{}
+			}
+			added += len(playable)
+			batches++
+
+			// Single videos come in one batch, so there's only progress
+			// to show from the second one on
+			if batches > 1 && time.Since(lastUpdate) > loadingUpdateInterval {
+				lastUpdate = time.Now()
+				msg := fmt.Sprintf("Loading playlist %v... (%v items so far)", playlistTitle, added)
+				if err := m.Update(&MessageData{Content: msg}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil && added == 0 {
 			if exerr, ok := err.(*extractor.Error); ok && exerr.Err == ytdl.ErrUnsupportedUrl {
 				return ErrUnsupportedUrl
 			}
+			if errors.Is(err, context.DeadlineExceeded) {
+				return ErrExtractTimeout
+			}
 			return err
 		}
-
-		cl.CmdCh <- player.CmdAddBack(data)
+		if added == 0 {
+			if unavailable > 0 {
+				return UserError{fmt.Errorf("none of the %v videos of playlist %v are available", unavailable, playlistTitle)}
+			}
+			return UserError{errors.New("extractor returned no results")}
+		}
 
 		var msg string
-		if len(data) == 1 {
-			msg = fmt.Sprintf("Added %v to queue", data[0].Title)
-		} else if len(data) > 0 {
-			msg = fmt.Sprintf("Added playlist %v to queue (%v items)", data[0].PlaylistTitle, len(data))
+		if added+unavailable == 1 {
+			msg = fmt.Sprintf("Added %v to queue", first.Title)
 		} else {
-			return UserError{errors.New("extractor returned no results")}
+			msg = fmt.Sprintf("Added playlist %v to queue (%v items)", playlistTitle, added)
+		}
+		if first.StartOffset > 0 {
+			msg += fmt.Sprintf(", starting at %v", util.FormatDurationSeconds(first.StartOffset))
+		}
+		if added+unavailable == 1 && first.MatchConfidence > 0 && first.MatchConfidence < lowMatchConfidence {
+			msg += " (couldn't find an exact match, this might be a different version or song)"
+		}
+		if unavailable > 0 {
+			msg += fmt.Sprintf(", skipped %v unavailable", unavailable)
+		}
+		if err != nil {
+			// Whatever was loaded before the error stays in the queue
+			msg += fmt.Sprintf("; couldn't load the rest: %v", err)
 		}
 
-		if err := m.Message(&MessageData{Content: msg}); err != nil {
+		if err := m.Update(&MessageData{Content: msg}); err != nil {
 			return err
 		}
 		return nil
@@ -527,7 +733,6 @@ func main() {
 
 		track := queue.At(i)
 		url := track.SourceUrl
-		id := strings.TrimSuffix(strings.TrimPrefix(url, "https://www.youtube.com/watch?v="), "/")
 		var desc string
 		if i == 0 {
 			if queue.Paused {
@@ -541,19 +746,47 @@ func main() {
 		} else {
 			desc = strconv.Itoa(i)
 		}
-		return &dc.MessageEmbed{
+
+		// e.g. "Head of NASA and the 2 Amish Boys (2010) • 1,234,567 views"
+		var details []string
+		if track.IsLive {
+			details = append(details, "Live")
+		}
+		if track.Album != "" && track.Year != 0 {
+			details = append(details, fmt.Sprintf("%v (%v)", track.Album, track.Year))
+		} else if track.Album != "" {
+			details = append(details, track.Album)
+		} else if track.Year != 0 {
+			details = append(details, strconv.Itoa(track.Year))
+		}
+		if track.Views != 0 {
+			details = append(details, util.FormatCount(track.Views)+" views")
+		}
+		if len(details) > 0 {
+			desc += "\n" + strings.Join(details, " • ")
+		}
+
+		embed := &dc.MessageEmbed{
 			Title:       track.Title,
 			Description: desc,
 			URL:         url + "/" + strconv.Itoa(i),
-			Thumbnail: &dc.MessageEmbedThumbnail{
-				URL: "https://i.ytimg.com/vi/" + id + "/mqdefault.jpg",
-			},
 		}
+		artist := track.Artist
+		if artist == "" {
+			artist = track.Uploader
+		}
+		if artist != "" {
+			embed.Author = &dc.MessageEmbedAuthor{Name: artist}
+		}
+		if track.Thumbnail != "" {
+			embed.Thumbnail = &dc.MessageEmbedThumbnail{URL: track.Thumbnail}
+		}
+		return embed
 	}
 
-	var commandHandlers map[string]func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error
-	commandHandlers = map[string]func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error{
-		"queue": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+	var commandHandlers map[string]func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error
+	commandHandlers = map[string]func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error{
+		"queue": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -596,7 +829,7 @@ func main() {
 			}
 			return nil
 		},
-		"play": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"play": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			opts := getOptions(d)
 			inputI, exists := opts["url-or-query"]
 			if exists {
@@ -609,12 +842,10 @@ func main() {
 
 				cl.CmdCh <- player.CmdSkipAll{}
 
-				err = addToQueue(s, m, cl, input)
+				err = addToQueue(s, m, cl, input, true)
 				if err != nil {
 					return err
 				}
-
-				cl.CmdCh <- player.CmdPlay{}
 			} else {
 				cl, err, _ := getClient(s, ia, false)
 				if err != nil {
@@ -641,13 +872,13 @@ func main() {
 			}
 			return nil
 		},
-		"add": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"add": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, created := getClient(s, ia, true)
 			if err != nil {
 				return err
 			}
 
-			err = addToQueue(s, m, cl, d.Options[0].StringValue())
+			err = addToQueue(s, m, cl, d.Options[0].StringValue(), false)
 			if err != nil {
 				return err
 			}
@@ -659,7 +890,7 @@ func main() {
 			}
 			return nil
 		},
-		"pause": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"pause": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -674,7 +905,7 @@ func main() {
 			}
 			return nil
 		},
-		"loop": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"loop": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -692,28 +923,71 @@ func main() {
 			}
 			return nil
 		},
-		"stop": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"stop": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
 			}
 			ch := make(chan struct{})
-			cl.CmdCh <- player.CmdPlayFileAndStop{ch, resByeOpus}
+			cl.CmdCh <- player.CmdPlayFileAndStop{DoneCh: ch, Data: resByeOpus}
 			if err := m.Message(&MessageData{Content: "Bye, have a great time"}); err != nil {
 				return err
 			}
 			<-ch
+			rec, recording := stopRecording(cl, ia.GuildID)
 			clients.Delete(ia.GuildID)
 			close(cl.CmdCh)
+			if recording {
+				if err := sendRecording(m, rec); err != nil {
+					return err
+				}
+			}
 			return nil
 		},
-		"disconnect": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"disconnect": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			return commandHandlers["stop"](s, m, ia, d)
 		},
-		"dc": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"record": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+			cl, err, _ := getClient(s, ia, false)
+			if err != nil {
+				return err
+			}
+			switch d.Options[0].Name {
+			case "start":
+				if _, exists := recordings.Load(ia.GuildID); exists {
+					return ErrAlreadyRecording
+				}
+				rec, err := newRecording()
+				if err != nil {
+					return err
+				}
+				if _, exists := recordings.LoadOrStore(ia.GuildID, rec); exists {
+					rec.Remove()
+					return ErrAlreadyRecording
+				}
+				cl.CmdCh <- player.CmdSetTap(rec.WriteFrame)
+				if err := m.Message(&MessageData{Content: "Started recording, use `record stop` to finish"}); err != nil {
+					return err
+				}
+			case "stop":
+				rec, recording := stopRecording(cl, ia.GuildID)
+				if !recording {
+					return ErrNotRecording
+				}
+				if err := m.StartThinking(); err != nil {
+					rec.Remove()
+					return err
+				}
+				if err := sendRecording(m, rec); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"dc": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			return commandHandlers["stop"](s, m, ia, d)
 		},
-		"jump": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"jump": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			track := d.Options[0].StringValue()
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
@@ -739,7 +1013,7 @@ func main() {
 			}
 			return nil
 		},
-		"seek": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"seek": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -788,7 +1062,7 @@ func main() {
 			}
 			return nil
 		},
-		"pos": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"pos": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -815,7 +1089,7 @@ func main() {
 			}
 			return nil
 		},
-		"speed": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"speed": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			opts := getOptions(d)
 			inputI, exists := opts["speed"]
 
@@ -838,7 +1112,7 @@ func main() {
 				return nil
 			}
 		},
-		"shuffle": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"shuffle": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -849,7 +1123,7 @@ func main() {
 			}
 			return nil
 		},
-		"unshuffle": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"unshuffle": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -864,7 +1138,7 @@ func main() {
 			}
 			return nil
 		},
-		"swap": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"swap": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -890,13 +1164,13 @@ func main() {
 			}
 
 			ta, tb := queue.At(a), queue.At(b)
-			cl.CmdCh <- player.CmdSwap{a, b}
-			if err := m.Message(&MessageData{Content: fmt.Sprintf("Swapped item %v: '%v' with %v: '%v'", ta.Title, tb.Title)}); err != nil {
+			cl.CmdCh <- player.CmdSwap{A: a, B: b}
+			if err := m.Message(&MessageData{Content: fmt.Sprintf("Swapped item %v: '%v' with %v: '%v'", a, ta.Title, b, tb.Title)}); err != nil {
 				return err
 			}
 			return nil
 		},
-		"delete": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"delete": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -930,7 +1204,7 @@ func main() {
 			}
 			return nil
 		},
-		"delete-from": func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+		"delete-from": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			cl, err, _ := getClient(s, ia, false)
 			if err != nil {
 				return err
@@ -958,6 +1232,42 @@ func main() {
 			}
 			return nil
 		},
+		"fix-match": func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+			cl, err, _ := getClient(s, ia, false)
+			if err != nil {
+				return err
+			}
+			queue := cl.GetQueue()
+			opts := getOptions(d)
+			a, err := getTrackNum(cl, opts["track"].StringValue())
+			if err != nil {
+				return err
+			}
+			if err := checkQueueBounds(queue, a); err != nil {
+				return err
+			}
+			track := queue.At(a)
+			vUrl := opts["video"].StringValue()
+
+			ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+			defer cancel()
+			if err := extractor.FixMatch(ctx, cfg.Extractors, track.SourceUrl, vUrl); err != nil {
+				if errors.Is(err, extractor.ErrNotMatched) {
+					return UserError{fmt.Errorf("'%v' isn't played from a search result, so there's no match to fix", track.Title)}
+				}
+				if errors.Is(err, match.ErrInvalidMatchUrl) || errors.Is(err, extractor.ErrUnavailable) {
+					return UserError{err}
+				}
+				return err
+			}
+			// Copies of the track that were already queued get the new video
+			// too
+			cl.CmdCh <- player.CmdReloadStream(track.SourceUrl)
+			if err := m.Message(&MessageData{Content: fmt.Sprintf("'%v' is now played from %v", track.Title, vUrl)}); err != nil {
+				return err
+			}
+			return nil
+		},
 	}
 
 	autocompleteBySearch := func(s *dc.Session, ia *dc.Interaction, input string) error {
@@ -970,28 +1280,51 @@ func main() {
 				},
 			}
 		} else if input != "" {
-			res, err := extractor.Search(cfg.Extractors, input)
-			if err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+			defer cancel()
+			res, err := extractor.Search(ctx, cfg.Extractors, input)
+			if errors.Is(err, context.DeadlineExceeded) {
+				// Better to show no results than to not respond in time
+				fmt.Println("Autocomplete search timed out:", input)
+				res = nil
+			} else if err != nil {
 				return err
 			}
 
-			choices = make([]*dc.ApplicationCommandOptionChoice, len(res))
-			for i, v := range res {
+			if len(res) > maxAutocompleteChoices {
+				res = res[:maxAutocompleteChoices]
+			}
+
+			// Only show where the results are from if they aren't all from
+			// the same site
+			showSource := false
+			for _, v := range res {
+				if v.Source != res[0].Source {
+					showSource = true
+					break
+				}
+			}
+
+			choices = make([]*dc.ApplicationCommandOptionChoice, 0, len(res))
+			for _, v := range res {
+				var prefix string
+				if showSource {
+					prefix = "[" + v.Source + "] "
+				}
 				switch {
 				case v.Title != "":
-					var prefix string
 					if v.OfficialArtist {
-						prefix = "🎵 "
+						prefix += "🎵 "
 					}
-					choices[i] = &dc.ApplicationCommandOptionChoice{
+					choices = append(choices, &dc.ApplicationCommandOptionChoice{
 						Name:  prefix + v.Title,
 						Value: v.SourceUrl,
-					}
+					})
 				case v.PlaylistTitle != "":
-					choices[i] = &dc.ApplicationCommandOptionChoice{
-						Name:  "𝘗𝘭𝘢𝘺𝘭𝘪𝘴𝘵: " + v.PlaylistTitle,
+					choices = append(choices, &dc.ApplicationCommandOptionChoice{
+						Name:  prefix + "𝘗𝘭𝘢𝘺𝘭𝘪𝘴𝘵: " + v.PlaylistTitle,
 						Value: v.PlaylistUrl,
-					}
+					})
 				}
 			}
 		}
@@ -1046,6 +1379,59 @@ func main() {
 		return nil
 	}
 
+	// Lists the videos the track chosen in the "track" option may be played
+	// from, most likely first
+	autocompleteMatch := func(s *dc.Session, ia *dc.Interaction, trackInput, input string) error {
+		var choices []*dc.ApplicationCommandOptionChoice
+		if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
+			choices = []*dc.ApplicationCommandOptionChoice{
+				{
+					Name:  input,
+					Value: input,
+				},
+			}
+		} else if cl, err, _ := getClient(s, ia, false); err == nil {
+			var res []extractor.Data
+			if a, err := getTrackNum(cl, trackInput); err == nil && cl.GetQueue().At(a) != nil {
+				ctx, cancel := context.WithTimeout(context.Background(), autocompleteTimeout)
+				defer cancel()
+				res, err = extractor.MatchCandidates(ctx, cfg.Extractors, cl.GetQueue().At(a).SourceUrl)
+				if err != nil {
+					// Better to show no results than to not respond in time
+					fmt.Println("Autocomplete match candidates:", err)
+					res = nil
+				}
+			}
+
+			if len(res) > maxAutocompleteChoices {
+				res = res[:maxAutocompleteChoices]
+			}
+
+			choices = make([]*dc.ApplicationCommandOptionChoice, 0, len(res))
+			for _, v := range res {
+				name := fmt.Sprintf("%.0f%% %v (%v)", v.MatchConfidence*100, v.Title, v.Uploader)
+				if v.Duration >= 0 {
+					name += " " + util.FormatDurationSeconds(v.Duration)
+				}
+				choices = append(choices, &dc.ApplicationCommandOptionChoice{
+					Name:  name,
+					Value: v.SourceUrl,
+				})
+			}
+		}
+
+		err := s.InteractionRespond(ia, &dc.InteractionResponse{
+			Type: dc.InteractionApplicationCommandAutocompleteResult,
+			Data: &dc.InteractionResponseData{
+				Choices: choices,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
 	autocompleteHandlers := map[string]func(s *dc.Session, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error{
 		"play": func(s *dc.Session, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			opts := getOptions(d)
@@ -1082,9 +1468,102 @@ func main() {
 		"delete-from": func(s *dc.Session, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
 			return autocompleteTrack(s, ia, d.Options[0].StringValue())
 		},
+		"fix-match": func(s *dc.Session, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) error {
+			opts := getOptions(d)
+			track, video := opts["track"], opts["video"]
+			if track != nil && track.Focused {
+				return autocompleteTrack(s, ia, track.StringValue())
+			}
+			if track != nil && video != nil && video.Focused {
+				return autocompleteMatch(s, ia, track.StringValue(), video.StringValue())
+			}
+			return ErrInvalidAutocompleteCall
+		},
 	}
 
-	componentHandlers := map[string]func(s *dc.Session, m *MessageWriter, ia *dc.Interaction, d *dc.MessageComponentInteractionData) error{}
+	componentHandlers := map[string]func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.MessageComponentInteractionData) error{}
+
+	// Command settings may be swapped out at runtime by a reload
+	var cmdCfgMu sync.RWMutex
+	cmdCfg := cfg.Commands
+	commandEnabled := func(guildId, name string) bool {
+		cmdCfgMu.RLock()
+		defer cmdCfgMu.RUnlock()
+		return cmdCfg.Enabled(guildId, name)
+	}
+	textPrefix := func() string {
+		cmdCfgMu.RLock()
+		defer cmdCfgMu.RUnlock()
+		return cmdCfg.TextPrefix
+	}
+
+	// Runs a command from any frontend (slash or text command) and reports
+	// errors back to the user
+	runCommand := func(s *dc.Session, m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) {
+		if !commandEnabled(ia.GuildID, d.Name) {
+			if err := m.Message(&MessageData{Content: "This command is disabled on this server"}); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return
+		}
+		if h, exists := commandHandlers[d.Name]; exists {
+			if err := h(s, m, ia, d); err != nil {
+				if _, ok := err.(UserError); ok {
+					if err := m.Message(&MessageData{Content: util.CapitalizeFirst(err.Error())}); err != nil {
+						fmt.Printf("Error: %v\n", err)
+					}
+				} else {
+					fmt.Printf("Error in commandHandlers[%v]: %v\n", d.Name, err)
+					if err := m.Message(&MessageData{Content: "An internal error occurred :("}); err != nil {
+						fmt.Printf("Error: %v\n", err)
+					}
+				}
+			}
+		}
+	}
+
+	// Headless mode: play into a file and take commands from the terminal
+	if repl {
+		var out *os.File
+		if replOutput == "-" {
+			out = os.Stdout
+			// Keep all other output (including that of other packages)
+			// from ending up in the audio stream
+			os.Stdout = os.Stderr
+		} else {
+			out, err = os.Create(replOutput)
+			if err != nil {
+				fmt.Println("Error:", err)
+				return
+			}
+			defer out.Close()
+		}
+
+		frameCh := make(chan []byte)
+		stopSink, sinkErrCh := runReplSink(audio.NewOggOpusWriter(out), frameCh)
+		newClient = func(s *dc.Session, ia *dc.Interaction) (player.Client, error) {
+			return player.NewClient(cfg.Extractors, cfg.FfmpegPath, frameCh), nil
+		}
+
+		fmt.Println("Running in REPL mode, writing audio to", replOutput)
+		fmt.Println("Type `help` for a list of commands")
+		runRepl(os.Stdin, os.Stdout, commands, func(m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData) {
+			runCommand(nil, m, ia, d)
+		})
+
+		if clI, ok := clients.LoadAndDelete(replId); ok {
+			cl := clI.(player.Client)
+			if rec, recording := stopRecording(cl, replId); recording {
+				rec.Remove()
+			}
+			close(cl.CmdCh)
+		}
+		stopSink <- struct{}{}
+		if err := <-sinkErrCh; err != nil {
+			fmt.Println("Error writing audio:", err)
+		}
+		return
+	}
 
 	// Create Discord session
 	dg, err := dc.New("Bot " + cfg.Token)
@@ -1093,6 +1572,9 @@ func main() {
 		return
 	}
 	dg.Identify.Intents = dc.IntentsAllWithoutPrivileged
+	if cfg.Commands.TextPrefix != "" {
+		dg.Identify.Intents |= dc.IntentMessageContent
+	}
 
 	// Set up handlers
 	readyCh := make(chan string)
@@ -1104,29 +1586,19 @@ func main() {
 		switch e.Type {
 		case dc.InteractionApplicationCommand:
 			d := e.ApplicationCommandData()
-			m := NewMessageWriter(s, e.Interaction)
+			m := NewInteractionMessageWriter(s, e.Interaction)
 			if e.GuildID == "" {
 				if err := m.Message(&MessageData{Content: "This bot only works on servers"}); err != nil {
 					fmt.Printf("Error: %v\n", err)
 				}
 				return
 			}
-			if h, exists := commandHandlers[d.Name]; exists {
-				if err := h(s, m, e.Interaction, &d); err != nil {
-					if _, ok := err.(UserError); ok {
-						if err := m.Message(&MessageData{Content: util.CapitalizeFirst(err.Error())}); err != nil {
-							fmt.Printf("Error: %v\n", err)
-						}
-					} else {
-						fmt.Printf("Error in commandHandlers[%v]: %v\n", d.Name, err)
-						if err := m.Message(&MessageData{Content: "An internal error occurred :("}); err != nil {
-							fmt.Printf("Error: %v\n", err)
-						}
-					}
-				}
-			}
+			runCommand(s, m, e.Interaction, &d)
 		case dc.InteractionApplicationCommandAutocomplete:
 			d := e.ApplicationCommandData()
+			if !commandEnabled(e.GuildID, d.Name) {
+				return
+			}
 			if h, exists := autocompleteHandlers[d.Name]; exists {
 				if err := h(s, e.Interaction, &d); err != nil {
 					fmt.Printf("Error in autocompleteHandlers[%v]: %v\n", d.Name, err)
@@ -1134,7 +1606,7 @@ func main() {
 			}
 		case dc.InteractionMessageComponent:
 			d := e.MessageComponentData()
-			m := NewMessageWriter(s, e.Interaction)
+			m := NewInteractionMessageWriter(s, e.Interaction)
 			if h, exists := componentHandlers[d.CustomID]; exists {
 				if err := h(s, m, e.Interaction, &d); err != nil {
 					if _, ok := err.(UserError); ok {
@@ -1150,6 +1622,30 @@ func main() {
 			fmt.Println("Unhandled interaction type:", e.Type)
 		}
 	})
+	dg.AddHandler(func(s *dc.Session, e *dc.MessageCreate) {
+		// Messages from other bots are fine, since some of them relay chat
+		// from other platforms
+		if e.GuildID == "" || e.Author == nil || e.Author.ID == s.State.User.ID {
+			return
+		}
+		prefix := textPrefix()
+		if prefix == "" || !strings.HasPrefix(e.Content, prefix) {
+			return
+		}
+		m := NewChannelMessageWriter(s, e.Message)
+		d, err := parseTextCommand(commands, strings.TrimPrefix(e.Content, prefix))
+		if err != nil {
+			if err == ErrUnknownTextCommand {
+				// Might be meant for a different bot
+				return
+			}
+			if err := m.Message(&MessageData{Content: util.CapitalizeFirst(err.Error())}); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return
+		}
+		runCommand(s, m, textCommandInteraction(e.Message), d)
+	})
 
 	// Open Discord session
 	err = dg.Open()
@@ -1162,43 +1658,132 @@ func main() {
 	fmt.Printf("Logged in as %v\n", <-readyCh)
 
 	// Set up commands
+	var commandsMu sync.Mutex
+	var syncedGuilds map[string]struct{} // nil until commands are set up
+	syncGuildCommands := func(guildId string, cmds []*dc.ApplicationCommand) error {
+		where := "globally"
+		if guildId != "" {
+			where = "in guild " + guildId
+		}
+		res, err := syncCommands(dg, guildId, cmds)
+		if err != nil {
+			return fmt.Errorf("updating commands %v: %w", where, err)
+		}
+		if res.UpToDate() {
+			fmt.Printf("Commands %v are up to date (%v)\n", where, res.Unchanged)
+		} else {
+			fmt.Printf("Updated commands %v: %v\n", where, res)
+		}
+		return nil
+	}
+	updateCommands := func(cmdCfg config.CommandConfig, unregister bool) error {
+		commandsMu.Lock()
+		defer commandsMu.Unlock()
+
+		// Every guild we're in is checked, so that commands registered
+		// there previously (e.g. as test guild) are cleaned up
+		var guildIds []string
+		dg.State.RLock()
+		for _, v := range dg.State.Guilds {
+			guildIds = append(guildIds, v.ID)
+		}
+		dg.State.RUnlock()
+
+		var targets map[string][]*dc.ApplicationCommand
+		if unregister {
+			targets = commandTargets(nil, config.CommandConfig{}, guildIds)
+		} else {
+			targets = commandTargets(commands, cmdCfg, guildIds)
+		}
+
+		syncedGuilds = make(map[string]struct{}, len(targets))
+		for guildId, cmds := range targets {
+			if err := syncGuildCommands(guildId, cmds); err != nil {
+				return err
+			}
+			syncedGuilds[guildId] = struct{}{}
+		}
+		return nil
+	}
+	// Guilds joined while running haven't been synced yet
+	dg.AddHandler(func(s *dc.Session, e *dc.GuildCreate) {
+		if !registerCommands {
+			return
+		}
+		commandsMu.Lock()
+		defer commandsMu.Unlock()
+		if syncedGuilds == nil {
+			return
+		}
+		if _, ok := syncedGuilds[e.ID]; ok {
+			return
+		}
+		cmdCfgMu.RLock()
+		cmds := commandTargets(commands, cmdCfg, []string{e.ID})[e.ID]
+		cmdCfgMu.RUnlock()
+		if err := syncGuildCommands(e.ID, cmds); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		syncedGuilds[e.ID] = struct{}{}
+	})
 	if registerCommands {
 		fmt.Println("Registering commands...")
-		for i, v := range commands {
-			cmd, err := dg.ApplicationCommandCreate(dg.State.User.ID, "", v)
-			if err != nil {
-				fmt.Printf("Error adding command %v: %v\n", v.Name, err)
-				return
-			}
-			commands[i] = cmd
-			fmt.Printf(" %v/%v done\r", i+1, len(commands))
+		if err := updateCommands(cfg.Commands, false); err != nil {
+			fmt.Println("Error:", err)
+			return
 		}
-		fmt.Printf("%v commands registered\n", len(commands))
 	}
 
-	// Exit gracefully when the program is terminated
+	// Exit gracefully when the program is terminated, reload command
+	// settings on SIGHUP
 	fmt.Println("Bot is now running, press Ctrl+C to stop")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
-	<-sc
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+mainLoop:
+	for {
+		select {
+		case <-hupCh:
+			fmt.Println("Received SIGHUP, reloading command settings from", cfgfile)
+			newCfg, err := config.Load(cfgfile, true)
+			if err != nil {
+				fmt.Println("Error reloading configuration:", err)
+				continue
+			}
+			// Intents are only sent when connecting, and reconnecting would
+			// interrupt everything that's playing
+			if newCfg.Commands.TextPrefix != "" && dg.Identify.Intents&dc.IntentMessageContent == 0 {
+				fmt.Println("Warning: text-prefix requires the message content intent, restart the bot to enable it")
+			}
+			cmdCfgMu.Lock()
+			cmdCfg = newCfg.Commands
+			cmdCfgMu.Unlock()
+			if registerCommands {
+				if err := updateCommands(newCfg.Commands, false); err != nil {
+					fmt.Println("Error:", err)
+				}
+			}
+		case <-sc:
+			break mainLoop
+		}
+	}
 	fmt.Println()
 	fmt.Println("Received stop signal, shutting down cleanly")
 	clients.Range(func(key, value any) bool {
 		cl := value.(player.Client)
+		if rec, recording := stopRecording(cl, key.(string)); recording {
+			rec.Remove()
+		}
 		close(cl.CmdCh)
 		return true
 	})
 	if registerCommands && unregisterCommands {
 		fmt.Println("Unregistering commands...")
-		for i, v := range commands {
-			err := dg.ApplicationCommandDelete(dg.State.User.ID, "", v.ID)
-			if err != nil {
-				fmt.Printf("Error deleting command %v: %v\n", v.Name, err)
-				return
-			}
-			fmt.Printf(" %v/%v done\r", i+1, len(commands))
+		if err := updateCommands(config.CommandConfig{}, true); err != nil {
+			fmt.Println("Error:", err)
 		}
-		fmt.Printf("%v commands unregistered\n", len(commands))
 	}
 	dg.Close()
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	dc "github.com/bwmarrin/discordgo"
+
+	"git.nobrain.org/r4/dischord/audio"
+
+	"errors"
+	"os"
+	"time"
+)
+
+var (
+	ErrRecordingTooLarge   = errors.New("recording reached the maximum upload size and was cut off")
+	ErrRecordingFellBehind = errors.New("writing the recording fell behind, so some audio was left out")
+)
+
+const (
+	// Discord's upload limit for bots (minus some headroom for the last
+	// page, which is written after the limit is checked).
+	recordingMaxSize = 25*1024*1024 - 64*1024
+	// Frames which may be waiting to be written before any more are dropped
+	// (5 seconds of audio).
+	recordingBufferFrames = 5 * audio.FramesPerSecond
+)
+
+// A recording writes the frames played in a guild into a temporary Ogg/Opus
+// file. The frames are written from the recording's own goroutine, so slow
+// disks don't hold up playback.
+type recording struct {
+	frames  chan []byte
+	done    chan struct{}
+	dropped bool // only accessed through WriteFrame
+	file    *os.File
+	w       *audio.OggOpusWriter
+	size    int64
+	err     error // may only be read after done is closed
+	started time.Time
+}
+
+func newRecording() (*recording, error) {
+	f, err := os.CreateTemp("", "dischord-recording-*.opus")
+	if err != nil {
+		return nil, err
+	}
+	r := &recording{
+		frames:  make(chan []byte, recordingBufferFrames),
+		done:    make(chan struct{}),
+		file:    f,
+		started: time.Now(),
+	}
+	r.w = audio.NewOggOpusWriter(writerFunc(func(p []byte) (int, error) {
+		n, err := r.file.Write(p)
+		r.size += int64(n)
+		return n, err
+	}))
+	go r.run()
+	return r, nil
+}
+
+func (r *recording) run() {
+	defer close(r.done)
+	for frame := range r.frames {
+		if r.err != nil {
+			continue
+		}
+		if r.size >= recordingMaxSize {
+			r.err = ErrRecordingTooLarge
+			continue
+		}
+		r.err = r.w.WritePacket(frame)
+	}
+}
+
+// Used as the player tap, so it must never block. Errors are kept until the
+// recording is finished, since the player can't do anything about them.
+func (r *recording) WriteFrame(frame []byte) {
+	select {
+	case r.frames <- frame:
+	default:
+		r.dropped = true
+	}
+}
+
+// Stops writing frames once all queued ones are written. WriteFrame must not
+// be called anymore after this.
+func (r *recording) stop() {
+	select {
+	case <-r.done:
+	default:
+		close(r.frames)
+		<-r.done
+	}
+}
+
+// Finishes the recording and returns it as an uploadable file, along with
+// any error that occurred while recording. The file is valid even if there
+// was an error, as long as it isn't nil. Call Remove once the file has been
+// uploaded.
+func (r *recording) Finish() (*dc.File, error) {
+	r.stop()
+	recErr := r.err
+	if recErr == nil && r.dropped {
+		recErr = ErrRecordingFellBehind
+	}
+	if err := r.w.Close(); err != nil {
+		return nil, err
+	}
+	if r.size == 0 {
+		return nil, errors.New("nothing was played during the recording")
+	}
+	if _, err := r.file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	return &dc.File{
+		Name:        "recording-" + r.started.Format("2006-01-02-15-04-05") + ".opus",
+		ContentType: "audio/ogg",
+		Reader:      r.file,
+	}, recErr
+}
+
+// Closes and deletes the temporary file.
+func (r *recording) Remove() {
+	r.stop()
+	r.file.Close()
+	os.Remove(r.file.Name())
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	dc "github.com/bwmarrin/discordgo"
+
+	"git.nobrain.org/r4/dischord/audio"
+
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stands in for the guild ID and user ID in REPL mode.
+const replId = "repl"
+
+// A TerminalMessageWriter prints command responses as plain text.
+type TerminalMessageWriter struct {
+	w io.Writer
+}
+
+func NewTerminalMessageWriter(w io.Writer) *TerminalMessageWriter {
+	return &TerminalMessageWriter{
+		w: w,
+	}
+}
+
+func (m *TerminalMessageWriter) StartThinking() error {
+	return nil
+}
+
+func (m *TerminalMessageWriter) Message(d *MessageData) error {
+	if d.Content != "" {
+		if _, err := fmt.Fprintln(m.w, d.Content); err != nil {
+			return err
+		}
+	}
+	for _, e := range d.Embeds {
+		if e == nil {
+			continue
+		}
+		line := e.Title
+		if e.Description != "" {
+			line = e.Description + ": " + line
+		}
+		for _, f := range e.Fields {
+			line += " | " + f.Name + ": " + f.Value
+		}
+		if _, err := fmt.Fprintln(m.w, "  "+line); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.Files {
+		path, err := saveFile(f)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(m.w, "  [file: %v]\n", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files would be uploaded to Discord, so in the terminal they're saved to the
+// working directory instead (without overwriting anything). Returns the path
+// of the saved file.
+func saveFile(f *dc.File) (string, error) {
+	ext := filepath.Ext(f.Name)
+	out, err := os.CreateTemp(".", strings.TrimSuffix(filepath.Base(f.Name), ext)+"-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, f.Reader); err != nil {
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return filepath.Abs(out.Name())
+}
+
+// Printed messages can't be replaced, so updates are just printed as well.
+func (m *TerminalMessageWriter) Update(d *MessageData) error {
+	return m.Message(d)
+}
+
+// Writes audio frames to w at the same pace Discord would play them, until
+// a struct{} is sent through the returned stop channel. The returned error
+// channel receives the result once the sink is done.
+func runReplSink(w *audio.OggOpusWriter, frames <-chan []byte) (stopCh chan<- struct{}, errCh <-chan error) {
+	stopch := make(chan struct{})
+	errch := make(chan error, 1)
+
+	go func() {
+		defer close(errch)
+
+		ticker := time.NewTicker(time.Duration(audio.FrameDuration * float64(time.Second)))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case frame := <-frames:
+				if err := w.WritePacket(frame); err != nil {
+					errch <- err
+					return
+				}
+				select {
+				case <-ticker.C:
+				case <-stopch:
+					errch <- w.Close()
+					return
+				}
+			case <-stopch:
+				errch <- w.Close()
+				return
+			}
+		}
+	}()
+
+	return stopch, errch
+}
+
+// Reads commands from in line by line and runs them until EOF or `quit`.
+// Commands are the same as the text commands, without any prefix.
+func runRepl(in io.Reader, out io.Writer, cmds []*dc.ApplicationCommand, run func(m MessageWriter, ia *dc.Interaction, d *dc.ApplicationCommandInteractionData)) {
+	help := func() {
+		sorted := append([]*dc.ApplicationCommand{}, cmds...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].Name < sorted[j].Name
+		})
+		for _, v := range sorted {
+			usage := v.Name
+			for _, opt := range v.Options {
+				if opt.Required {
+					usage += " <" + opt.Name + ">"
+				} else {
+					usage += " [" + opt.Name + "]"
+				}
+			}
+			fmt.Fprintf(out, "  %v\n      %v\n", usage, v.Description)
+		}
+		fmt.Fprintln(out, "  help\n      Show this help")
+		fmt.Fprintln(out, "  quit\n      Stop playback and exit")
+	}
+
+	ia := &dc.Interaction{
+		Type:    dc.InteractionApplicationCommand,
+		GuildID: replId,
+		Member: &dc.Member{
+			GuildID: replId,
+			User: &dc.User{
+				ID:       replId,
+				Username: replId,
+			},
+		},
+	}
+	m := NewTerminalMessageWriter(out)
+
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !sc.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		line := strings.TrimSpace(sc.Text())
+		switch line {
+		case "":
+			continue
+		case "help":
+			help()
+			continue
+		case "quit", "exit":
+			return
+		}
+
+		d, err := parseTextCommand(cmds, line)
+		if err != nil {
+			if err == ErrUnknownTextCommand {
+				fmt.Fprintln(out, "Unknown command, type `help` for a list of commands")
+			} else {
+				fmt.Fprintln(out, "Error:", err)
+			}
+			continue
+		}
+		run(m, ia, d)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	dc "github.com/bwmarrin/discordgo"
+
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrUnknownTextCommand = errors.New("unknown command")
+)
+
+// A ChannelMessageWriter responds to a text command by replying to the
+// message containing the command.
+type ChannelMessageWriter struct {
+	session *dc.Session
+	message *dc.Message
+	// The last reply sent; nil if none
+	last *dc.Message
+}
+
+func NewChannelMessageWriter(s *dc.Session, msg *dc.Message) *ChannelMessageWriter {
+	return &ChannelMessageWriter{
+		session: s,
+		message: msg,
+	}
+}
+
+func (m *ChannelMessageWriter) StartThinking() error {
+	return m.session.ChannelTyping(m.message.ChannelID)
+}
+
+func (m *ChannelMessageWriter) Message(d *MessageData) error {
+	msg, err := m.session.ChannelMessageSendComplex(m.message.ChannelID, &dc.MessageSend{
+		Content:    d.Content,
+		Embeds:     d.Embeds,
+		Components: d.Components,
+		Files:      d.Files,
+		Reference:  m.message.Reference(),
+		// Don't ping anyone, not even the user we're replying to
+		AllowedMentions: &dc.MessageAllowedMentions{},
+	})
+	if err != nil {
+		return err
+	}
+	m.last = msg
+	return nil
+}
+
+func (m *ChannelMessageWriter) Update(d *MessageData) error {
+	if m.last == nil {
+		return m.Message(d)
+	}
+	edit := dc.NewMessageEdit(m.last.ChannelID, m.last.ID)
+	edit.Content = &d.Content
+	edit.Embeds = d.Embeds
+	edit.Components = d.Components
+	edit.Files = d.Files
+	edit.AllowedMentions = &dc.MessageAllowedMentions{}
+	_, err := m.session.ChannelMessageEditComplex(edit)
+	return err
+}
+
+// Makes a fake interaction out of a message, so it can be passed to the
+// regular command handlers.
+func textCommandInteraction(msg *dc.Message) *dc.Interaction {
+	member := &dc.Member{}
+	if msg.Member != nil {
+		*member = *msg.Member
+	}
+	// Message members don't contain the user, and webhook messages
+	// (e.g. relayed from other platforms) don't have a member at all
+	member.User = msg.Author
+	member.GuildID = msg.GuildID
+	return &dc.Interaction{
+		Type:      dc.InteractionApplicationCommand,
+		GuildID:   msg.GuildID,
+		ChannelID: msg.ChannelID,
+		Member:    member,
+		User:      msg.Author,
+	}
+}
+
+// Splits s into words, keeping anything in double quotes together.
+func splitTextCommandArgs(s string) ([]string, error) {
+	var res []string
+	var curr strings.Builder
+	inWord, inQuotes := false, false
+	for _, c := range s {
+		switch {
+		case c == '"':
+			inQuotes = !inQuotes
+			inWord = true
+		case unicode.IsSpace(c) && !inQuotes:
+			if inWord {
+				res = append(res, curr.String())
+				curr.Reset()
+				inWord = false
+			}
+		default:
+			curr.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inQuotes {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		res = append(res, curr.String())
+	}
+	return res, nil
+}
+
+// Parses a text command (without prefix) like `play never gonna give you up`
+// into the same data a slash command would produce. Arguments are assigned to
+// the command's options in order; any surplus words go to the last option if
+// it's a string.
+func parseTextCommand(cmds []*dc.ApplicationCommand, input string) (*dc.ApplicationCommandInteractionData, error) {
+	args, err := splitTextCommandArgs(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, ErrUnknownTextCommand
+	}
+
+	var cmd *dc.ApplicationCommand
+	for _, v := range cmds {
+		if v.Name == strings.ToLower(args[0]) {
+			cmd = v
+			break
+		}
+	}
+	if cmd == nil {
+		return nil, ErrUnknownTextCommand
+	}
+
+	opts, err := parseTextCommandOptions(cmd.Name, cmd.Options, args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &dc.ApplicationCommandInteractionData{
+		ID:      cmd.ID,
+		Name:    cmd.Name,
+		Options: opts,
+	}, nil
+}
+
+func parseTextCommandOptions(cmdName string, defs []*dc.ApplicationCommandOption, args []string) ([]*dc.ApplicationCommandInteractionDataOption, error) {
+	// Subcommands take the first argument as their name
+	if len(defs) > 0 && defs[0].Type == dc.ApplicationCommandOptionSubCommand {
+		var names []string
+		for _, def := range defs {
+			names = append(names, def.Name)
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%v: expected one of: %v", cmdName, strings.Join(names, ", "))
+		}
+		for _, def := range defs {
+			if def.Name == strings.ToLower(args[0]) {
+				opts, err := parseTextCommandOptions(cmdName+" "+def.Name, def.Options, args[1:])
+				if err != nil {
+					return nil, err
+				}
+				return []*dc.ApplicationCommandInteractionDataOption{
+					{
+						Name:    def.Name,
+						Type:    def.Type,
+						Options: opts,
+					},
+				}, nil
+			}
+		}
+		return nil, fmt.Errorf("%v: unknown subcommand '%v', expected one of: %v", cmdName, args[0], strings.Join(names, ", "))
+	}
+
+	var res []*dc.ApplicationCommandInteractionDataOption
+	for i, def := range defs {
+		if i >= len(args) {
+			if def.Required {
+				return nil, fmt.Errorf("%v: missing argument '%v'", cmdName, def.Name)
+			}
+			break
+		}
+
+		arg := args[i]
+		if i == len(defs)-1 && def.Type == dc.ApplicationCommandOptionString {
+			arg = strings.Join(args[i:], " ")
+		}
+
+		opt := &dc.ApplicationCommandInteractionDataOption{
+			Name: def.Name,
+			Type: def.Type,
+		}
+		switch def.Type {
+		case dc.ApplicationCommandOptionString:
+			opt.Value = arg
+		case dc.ApplicationCommandOptionInteger, dc.ApplicationCommandOptionNumber:
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil || (def.Type == dc.ApplicationCommandOptionInteger && n != float64(int64(n))) {
+				return nil, fmt.Errorf("%v: invalid number '%v' for argument '%v'", cmdName, arg, def.Name)
+			}
+			if (def.MinValue != nil && n < *def.MinValue) || (def.MaxValue != 0 && n > def.MaxValue) {
+				return nil, fmt.Errorf("%v: argument '%v' out of range", cmdName, def.Name)
+			}
+			// Discord sends all numbers as float64, which the handlers
+			// rely on
+			opt.Value = n
+		case dc.ApplicationCommandOptionBoolean:
+			b, err := strconv.ParseBool(arg)
+			if err != nil {
+				return nil, fmt.Errorf("%v: invalid boolean '%v' for argument '%v'", cmdName, arg, def.Name)
+			}
+			opt.Value = b
+		default:
+			return nil, fmt.Errorf("%v: argument '%v' is not supported in text commands", cmdName, def.Name)
+		}
+		res = append(res, opt)
+	}
+	if len(args) > len(defs) && (len(defs) == 0 || defs[len(defs)-1].Type != dc.ApplicationCommandOptionString) {
+		return nil, fmt.Errorf("%v: too many arguments", cmdName)
+	}
+	return res, nil
+}
@@ -24,9 +24,37 @@ var (
 type Config struct {
 	Token      string           `toml:"bot-token"`
 	FfmpegPath string           `toml:"ffmpeg-path"`
+	Commands   CommandConfig    `toml:"commands"`
 	Extractors extractor.Config `toml:"extractors"`
 }
 
+type CommandConfig struct {
+	// If set, commands are registered to these guilds only instead of
+	// globally. Guild commands are available instantly, whereas global
+	// commands may take a while to propagate, so this is mostly useful for
+	// testing.
+	TestGuildIds []string `toml:"test-guild-ids"`
+	// If set, messages starting with this prefix (e.g. "!") are interpreted
+	// as commands as well. Requires the message content intent to be enabled
+	// for the bot.
+	TextPrefix string                 `toml:"text-prefix"`
+	Guilds     map[string]GuildConfig `toml:"guilds"` // guild ID to config
+}
+
+type GuildConfig struct {
+	DisabledCommands []string `toml:"disabled-commands"`
+}
+
+// Reports whether the given command may be used in the given guild.
+func (c CommandConfig) Enabled(guildId, command string) bool {
+	for _, v := range c.Guilds[guildId].DisabledCommands {
+		if v == command {
+			return false
+		}
+	}
+	return true
+}
+
 const (
 	defaultToken = "insert your Discord bot token here"
 )
@@ -94,8 +122,9 @@ func macosEnableExecutable(filename string) error {
 }
 
 // Tries to load the given TOML config file. Returns an error if the
-// configuration file does not exist or is invalid.
-func Load(filename string) (*Config, error) {
+// configuration file does not exist or is invalid. The bot token may only be
+// left unset if requireToken is false (e.g. if we don't connect to Discord).
+func Load(filename string, requireToken bool) (*Config, error) {
 	cfg := &Config{}
 	meta, err := toml.DecodeFile(filename, cfg)
 	if err != nil {
@@ -107,14 +136,20 @@ func Load(filename string) (*Config, error) {
 	if undec := meta.Undecoded(); len(undec) > 0 {
 		return nil, fmt.Errorf("%v: field '%v' could not be decoded", filename, undec[0])
 	}
-	if cfg.Token == defaultToken || cfg.Token == "" {
+	if requireToken && (cfg.Token == defaultToken || cfg.Token == "") {
 		return nil, ErrTokenNotSet
 	}
+	if cfg.Extractors == nil {
+		cfg.Extractors = make(extractor.Config)
+	}
+	cfg.Extractors.FillDefaults()
 	if err := cfg.Extractors.CheckValidity(); err != nil {
 		return nil, err
 	}
-	if _, err := exec.LookPath(cfg.Extractors["youtube-dl"]["youtube-dl-path"].(string)); err != nil {
-		return nil, ErrInvalidYoutubeDlPath
+	if cfg.Extractors.Enabled("youtube-dl") {
+		if _, err := exec.LookPath(cfg.Extractors["youtube-dl"]["youtube-dl-path"].(string)); err != nil {
+			return nil, ErrInvalidYoutubeDlPath
+		}
 	}
 	if _, err := exec.LookPath(cfg.FfmpegPath); err != nil {
 		return nil, ErrInvalidFfmpegPath
@@ -126,7 +161,10 @@ func Load(filename string) (*Config, error) {
 // prints information and instructions for the user to stdout.
 func Autoconf(filename string) (*Config, error) {
 	cfg := &Config{
-		Token:      defaultToken,
+		Token: defaultToken,
+		Commands: CommandConfig{
+			TestGuildIds: []string{},
+		},
 		Extractors: extractor.DefaultConfig(),
 	}
 
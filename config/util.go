@@ -187,5 +187,4 @@ func unarchiveSingleFile(archive, target string) error {
 	} else {
 		return ErrUnsupportedArchive
 	}
-	return nil
 }
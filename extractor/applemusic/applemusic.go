@@ -0,0 +1,213 @@
+package applemusic
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/match"
+	exutil "git.nobrain.org/r4/dischord/extractor/util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrNoMetadata = errors.New("unable to find the metadata in the page")
+)
+
+const baseUrl = "https://music.apple.com"
+
+// Each page has its metadata as JSON-LD (see https://schema.org), so it
+// doesn't need the API, which requires a developer token.
+type ldData struct {
+	Type          string    `json:"@type"`
+	Name          string    `json:"name"`
+	Url           string    `json:"url"`
+	Duration      string    `json:"duration"`      // ISO 8601, e.g. "PT4M20S"
+	DatePublished string    `json:"datePublished"` // e.g. "2010-02-25"
+	Image         string    `json:"image"`
+	ByArtist      ldArtists `json:"byArtist"`
+	InAlbum       struct {
+		Name string `json:"name"`
+	} `json:"inAlbum"`
+	// Song pages are about the composition, with the recording in here
+	Audio *ldData `json:"audio"`
+	// Albums have tracks, playlists have track
+	Tracks []ldData `json:"tracks"`
+	Track  []ldData `json:"track"`
+}
+
+// Either a single artist or a list of them.
+type ldArtists []struct {
+	Name string `json:"name"`
+}
+
+func (a *ldArtists) UnmarshalJSON(data []byte) error {
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		var v struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		*a = ldArtists{v}
+		return nil
+	}
+	var v []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+func (a ldArtists) names() []string {
+	var res []string
+	for _, v := range a {
+		res = append(res, v.Name)
+	}
+	return res
+}
+
+func (d ldData) year() int {
+	if len(d.DatePublished) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(d.DatePublished[:4])
+	return year
+}
+
+var isoDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)(?:\.\d+)?S)?)?$`)
+
+// Returns -1 if s isn't a valid duration.
+func parseIsoDuration(s string) int {
+	m := isoDurationRegexp.FindStringSubmatch(s)
+	if m == nil || s == "P" {
+		return -1
+	}
+	res := 0
+	for i, factor := range []int{24 * 60 * 60, 60 * 60, 60, 1} {
+		if m[i+1] != "" {
+			n, _ := strconv.Atoi(m[i+1])
+			res += n * factor
+		}
+	}
+	return res
+}
+
+// Returns the JSON-LD of the page of the resource of the given kind (e.g.
+// "song") and ID.
+func getLdData(ctx context.Context, client *http.Client, country, kind, id string) (ldData, error) {
+	var res ldData
+	found := false
+	err := exutil.GetHTMLScriptFunc(ctx, client, baseUrl+"/"+country+"/"+kind+"/"+id, false, func(code string) bool {
+		code = strings.TrimSpace(code)
+		if !strings.HasPrefix(code, "{") || !strings.Contains(code, `"@context"`) {
+			return true
+		}
+		var data ldData
+		if json.Unmarshal([]byte(code), &data) != nil || data.Name == "" {
+			return true
+		}
+		res = data
+		found = true
+		return false
+	})
+	if !found && (err == nil || err == io.EOF) {
+		// Read the whole page without finding it
+		return ldData{}, ErrNoMetadata
+	}
+	if err != nil {
+		return ldData{}, err
+	}
+	return res, nil
+}
+
+func getSong(ctx context.Context, client *http.Client, country, songId string) (match.Track, error) {
+	data, err := getLdData(ctx, client, country, "song", songId)
+	if err != nil {
+		return match.Track{}, err
+	}
+	rec := data
+	if data.Audio != nil {
+		rec = *data.Audio
+	}
+	if len(rec.ByArtist) == 0 {
+		return match.Track{}, ErrNoMetadata
+	}
+
+	res := match.Track{
+		SourceUrl: data.Url,
+		Name:      rec.Name,
+		Artists:   rec.ByArtist.names(),
+		Album:     rec.InAlbum.Name,
+		Year:      rec.year(),
+		Thumbnail: rec.Image,
+		Duration:  parseIsoDuration(rec.Duration),
+	}
+	if res.Name == "" {
+		res.Name = data.Name
+	}
+	if res.Year == 0 {
+		res.Year = data.year()
+	}
+	if res.Thumbnail == "" {
+		res.Thumbnail = data.Image
+	}
+	return res, nil
+}
+
+// Returns the tracks of an album or playlist (given by kind).
+func getTrackList(ctx context.Context, client *http.Client, country, kind, id string) ([]extractor.Data, error) {
+	data, err := getLdData(ctx, client, country, kind, id)
+	if err != nil {
+		return nil, err
+	}
+	tracks := data.Tracks
+	if kind == "playlist" {
+		tracks = data.Track
+	}
+
+	var res []extractor.Data
+	for _, v := range tracks {
+		track := match.Track{
+			Name:      v.Name,
+			Artists:   v.ByArtist.names(),
+			Album:     v.InAlbum.Name,
+			Year:      v.year(),
+			Thumbnail: v.Image,
+		}
+		if kind == "album" {
+			// The album's tracks don't repeat what they have in common
+			if len(track.Artists) == 0 {
+				track.Artists = data.ByArtist.names()
+			}
+			track.Album = data.Name
+			if track.Year == 0 {
+				track.Year = data.year()
+			}
+			if track.Thumbnail == "" {
+				track.Thumbnail = data.Image
+			}
+		}
+		res = append(res, extractor.Data{
+			SourceUrl:     v.Url,
+			Title:         track.TitleString(),
+			Uploader:      track.ArtistsString(),
+			Artist:        track.ArtistsString(),
+			Album:         track.Album,
+			Year:          track.Year,
+			Thumbnail:     track.Thumbnail,
+			Duration:      parseIsoDuration(v.Duration),
+			PlaylistUrl:   data.Url,
+			PlaylistTitle: data.Name,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,70 @@
+package applemusic_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/applemusic"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureAppleMusic(t *testing.T) {
+	cover := "https://is1-ssl.mzstatic.com/image/thumb/Music/fixtureAlb1/600x600bb.jpg"
+	for _, input := range []string{
+		"https://music.apple.com/us/song/black-velvet/fixtureSng1",
+		"https://music.apple.com/us/album/head-of-nasa-and-the-2-amish-boys/fixtureAlb1?i=fixtureSng1",
+	} {
+		data, err := extractor.Extract(context.Background(), fixture.Config(t), input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		if len(data) == 1 {
+			fixture.CheckExpires(t, &data[0], 21540*time.Second)
+		}
+		// There's no ISRC, so it's found by its name
+		fixture.CheckData(t, data, []extractor.Data{{
+			SourceUrl:       "https://music.apple.com/us/song/black-velvet/fixtureSng1",
+			StreamUrl:       "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-music&n=edcb&itag=251&sig=IHJFEDCBA",
+			Title:           "Infected Mushroom, Ninet Tayeb - Black Velvet",
+			Uploader:        "Infected Mushroom, Ninet Tayeb",
+			Artist:          "Infected Mushroom, Ninet Tayeb",
+			Album:           "Head of NASA and the 2 Amish Boys",
+			Year:            2010,
+			Thumbnail:       cover,
+			Duration:        212,
+			MatchConfidence: 1,
+		}})
+	}
+
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://music.apple.com/us/album/head-of-nasa-and-the-2-amish-boys/fixtureAlb1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	album := fixture.Playlist{Url: "https://music.apple.com/us/album/head-of-nasa-and-the-2-amish-boys/fixtureAlb1", Title: "Head of NASA and the 2 Amish Boys"}
+	// The album's artist, cover etc. go for all of its tracks
+	fixture.CheckData(t, data, []extractor.Data{
+		fixture.FromAlbum(album.Track("https://music.apple.com/us/song/black-velvet/fixtureSng1", "Infected Mushroom - Black Velvet", "Infected Mushroom", 260), album.Title, 2010, cover),
+		fixture.FromAlbum(album.Track("https://music.apple.com/us/song/fields-of-grey/fixtureSng3", "Infected Mushroom - Fields of Grey", "Infected Mushroom", 290), album.Title, 2010, cover),
+	})
+
+	data, err = extractor.Extract(context.Background(), fixture.Config(t), "https://music.apple.com/us/playlist/fixture-playlist/pl.fixture1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	pls := fixture.Playlist{Url: "https://music.apple.com/us/playlist/fixture-playlist/pl.fixture1", Title: "Fixture Playlist"}
+	// Playlists don't always say who the artists are
+	fixture.CheckData(t, data, []extractor.Data{
+		pls.Track("https://music.apple.com/us/song/black-velvet/fixtureSng1", "Black Velvet", "", 260),
+		pls.Track("https://music.apple.com/us/song/bliss-on-mushrooms/fixtureSng4", "Infected Mushroom - Bliss on Mushrooms", "Infected Mushroom", 432),
+	})
+
+	_, err = extractor.Extract(context.Background(), fixture.Config(t), "https://music.apple.com/us/song/fixtureMissing")
+	if !errors.Is(err, applemusic.ErrNoMetadata) {
+		t.Errorf("Expected error '%v' but got '%v'", applemusic.ErrNoMetadata, err)
+	}
+}
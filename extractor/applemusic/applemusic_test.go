@@ -0,0 +1,29 @@
+package applemusic
+
+import (
+	"testing"
+)
+
+func TestParseIsoDuration(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected int
+	}{
+		{"PT3M32S", 212},
+		{"PT4M", 240},
+		{"PT45S", 45},
+		{"PT1H2M3S", 3723},
+		{"P1DT1S", 86401},
+		{"PT3M32.5S", 212},
+		{"PT0S", 0},
+		{"P", -1},
+		{"", -1},
+		{"3M32S", -1},
+		{"PT3S32M", -1},
+		{"PT-3M", -1},
+	} {
+		if res := parseIsoDuration(test.input); res != test.expected {
+			t.Errorf("%q: expected %v but got %v", test.input, test.expected, res)
+		}
+	}
+}
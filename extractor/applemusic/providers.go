@@ -0,0 +1,119 @@
+package applemusic
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/match"
+
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	extractor.AddExtractor("apple-music", NewExtractor())
+}
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Only these are supported; the rest (e.g. artists) isn't something that
+// could be played
+var kinds = map[string]struct{}{
+	"song":     {},
+	"album":    {},
+	"playlist": {},
+}
+
+// Accepts links like https://music.apple.com/<country>/<kind>/<name>/<id>,
+// where the name is optional. Songs are often linked as part of their album,
+// with the song's ID in the query parameter i. Returns the country, the kind
+// of resource (e.g. "song") and its ID.
+func matches(input string) (country, kind, id string, ok bool) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", "", "", false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", "", false
+	}
+	if u.Host != "music.apple.com" {
+		return "", "", "", false
+	}
+	sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(sp) < 3 || len(sp) > 4 {
+		return "", "", "", false
+	}
+	country, kind, id = sp[0], sp[1], sp[len(sp)-1]
+	if _, ok := kinds[kind]; !ok || id == "" {
+		return "", "", "", false
+	}
+	if i := u.Query().Get("i"); kind == "album" && i != "" {
+		kind, id = "song", i
+	}
+	return country, kind, id, true
+}
+
+type Extractor struct {
+	matcher *match.Matcher
+}
+
+func NewExtractor() *Extractor {
+	return &Extractor{
+		matcher: match.NewMatcher("apple-music"),
+	}
+}
+
+func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{}
+}
+
+func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
+	_, _, _, ok := matches(input)
+	return ok
+}
+
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	country, kind, id, ok := matches(input)
+	if !ok {
+		return nil, ErrInvalidInput
+	}
+	client := extractor.HttpClient(cfg)
+	switch kind {
+	case "song":
+		track, err := getSong(ctx, client, country, id)
+		if err != nil {
+			return nil, err
+		}
+		d, err := e.matcher.Get(ctx, cfg, "song-"+id, track)
+		if err != nil {
+			return nil, err
+		}
+		return []extractor.Data{d}, nil
+	case "album", "playlist":
+		return getTrackList(ctx, client, country, kind, id)
+	}
+	return nil, ErrInvalidInput
+}
+
+// Songs are played from YouTube videos
+func (e *Extractor) MatchCandidates(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	country, kind, id, ok := matches(input)
+	if !ok || kind != "song" {
+		return nil, extractor.ErrNotMatched
+	}
+	track, err := getSong(ctx, extractor.HttpClient(cfg), country, id)
+	if err != nil {
+		return nil, err
+	}
+	return e.matcher.Candidates(ctx, cfg, track)
+}
+
+func (e *Extractor) FixMatch(ctx context.Context, cfg extractor.ProviderConfig, input, candidateUrl string) error {
+	_, kind, id, ok := matches(input)
+	if !ok || kind != "song" {
+		return extractor.ErrNotMatched
+	}
+	return e.matcher.Fix(ctx, cfg, "song-"+id, candidateUrl)
+}
@@ -0,0 +1,150 @@
+package bandcamp
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	exutil "git.nobrain.org/r4/dischord/extractor/util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoTralbumData      = errors.New("no track or album data found on the page")
+	ErrDecodingTralbum    = errors.New("error decoding track or album data")
+	ErrTrackUnavailable   = fmt.Errorf("%w: track can't be streamed (it may only be available for purchase)", extractor.ErrUnavailable)
+	ErrNoStreamableTracks = errors.New("album has no tracks that can be streamed")
+)
+
+// Stream URLs carry their expiry date in the token parameter; this is only
+// used if it can't be read.
+const defaultStreamUrlLifetime = 10 * time.Minute
+
+// A very reduced version of the JSON structure embedded in the data-tralbum
+// attribute of track and album pages
+type tralbumData struct {
+	Url      string `json:"url"`
+	Artist   string `json:"artist"`
+	ItemType string `json:"item_type"` // "track" or "album"
+	Current  struct {
+		Title string `json:"title"`
+		About string `json:"about"`
+	} `json:"current"`
+	TrackInfo []struct {
+		Title     string            `json:"title"`
+		TitleLink string            `json:"title_link"`
+		Artist    string            `json:"artist"` // only set if it differs from the album artist
+		Duration  float64           `json:"duration"`
+		File      map[string]string `json:"file"` // nil if the track can't be streamed
+	} `json:"trackinfo"`
+}
+
+// Embedded in the data-embed attribute; only needed for the album title of
+// track pages
+type embedData struct {
+	AlbumTitle string `json:"album_title"`
+}
+
+// Reads the expiry date off a stream URL, e.g.
+// ...?p=0&ts=1700000000&t=...&token=1700000000_...
+func streamUrlExpires(streamUrl string) time.Time {
+	u, err := url.Parse(streamUrl)
+	if err == nil {
+		token, _, _ := strings.Cut(u.Query().Get("token"), "_")
+		if ts, err := strconv.ParseInt(token, 10, 64); err == nil {
+			return time.Unix(ts, 0)
+		}
+	}
+	return time.Now().Add(defaultStreamUrlLifetime)
+}
+
+func getTralbum(ctx context.Context, client *http.Client, pageUrl string) (tralbumData, embedData, error) {
+	var tralbumJson, embedJson string
+	err := exutil.GetHTMLAttrsFunc(ctx, client, pageUrl, "script", func(attrs map[string]string) bool {
+		if v, ok := attrs["data-tralbum"]; ok {
+			tralbumJson, embedJson = v, attrs["data-embed"]
+			return false
+		}
+		return true
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		return tralbumData{}, embedData{}, err
+	}
+	if tralbumJson == "" {
+		return tralbumData{}, embedData{}, ErrNoTralbumData
+	}
+
+	var tralbum tralbumData
+	if err := json.Unmarshal([]byte(tralbumJson), &tralbum); err != nil {
+		return tralbumData{}, embedData{}, ErrDecodingTralbum
+	}
+	var embed embedData
+	if embedJson != "" {
+		// Not essential, so errors are ignored
+		json.Unmarshal([]byte(embedJson), &embed)
+	}
+	return tralbum, embed, nil
+}
+
+func getTralbumData(ctx context.Context, client *http.Client, pageUrl string) ([]extractor.Data, error) {
+	tralbum, embed, err := getTralbum(ctx, client, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := url.Parse(tralbum.Url)
+	if err != nil || tralbum.Url == "" {
+		base, _ = url.Parse(pageUrl)
+	}
+
+	var res []extractor.Data
+	for _, t := range tralbum.TrackInfo {
+		streamUrl := t.File["mp3-128"]
+		if streamUrl == "" {
+			continue
+		}
+		d := extractor.Data{
+			StreamUrl: streamUrl,
+			Title:     t.Title,
+			Uploader:  tralbum.Artist,
+			Duration:  int(t.Duration),
+			Expires:   streamUrlExpires(streamUrl),
+		}
+		if t.Artist != "" {
+			d.Uploader = t.Artist
+		}
+		if d.Duration <= 0 {
+			d.Duration = -1
+		}
+		if tralbum.ItemType == "track" {
+			d.SourceUrl = base.String()
+			d.Description = tralbum.Current.About
+			d.PlaylistTitle = embed.AlbumTitle
+		} else {
+			// Without a track page there's nothing to get a new stream URL
+			// from once this one expires
+			link, err := base.Parse(t.TitleLink)
+			if err != nil || t.TitleLink == "" {
+				continue
+			}
+			d.SourceUrl = link.String()
+			d.PlaylistUrl = base.String()
+			d.PlaylistTitle = tralbum.Current.Title
+		}
+		res = append(res, d)
+	}
+	if len(res) == 0 {
+		if tralbum.ItemType == "track" {
+			return nil, ErrTrackUnavailable
+		}
+		return nil, ErrNoStreamableTracks
+	}
+	return res, nil
+}
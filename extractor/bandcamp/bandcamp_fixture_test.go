@@ -0,0 +1,81 @@
+package bandcamp_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/bandcamp"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureBandcamp(t *testing.T) {
+	cfg := fixture.Config(t)
+	expires := time.Unix(1700000000, 0)
+
+	data, err := extractor.Extract(context.Background(), cfg, "https://fixture.bandcamp.com/track/prelude")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, []extractor.Data{{
+		SourceUrl:     "https://fixture.bandcamp.com/track/prelude",
+		StreamUrl:     "https://t4.bcbits.com/stream/fixture2001/mp3-128/2001?p=0&ts=1700000000&t=fixture&token=1700000000_fixture",
+		Title:         "Prelude",
+		PlaylistTitle: "Fixture Album",
+		Description:   "The first track.",
+		Uploader:      "Fixture Band",
+		Duration:      125,
+		Expires:       expires,
+	}})
+
+	// The third track can't be streamed and the last one has no page of its
+	// own to be extracted again from, so both are left out
+	data, err = extractor.Extract(context.Background(), cfg, "https://fixture.bandcamp.com/album/fixture-album")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, []extractor.Data{
+		{
+			SourceUrl:     "https://fixture.bandcamp.com/track/prelude",
+			StreamUrl:     "https://t4.bcbits.com/stream/fixture2001/mp3-128/2001?p=0&ts=1700000000&t=fixture&token=1700000000_fixture",
+			Title:         "Prelude",
+			PlaylistUrl:   "https://fixture.bandcamp.com/album/fixture-album",
+			PlaylistTitle: "Fixture Album",
+			Uploader:      "Fixture Band",
+			Duration:      125,
+			Expires:       expires,
+		},
+		{
+			SourceUrl:     "https://fixture.bandcamp.com/track/slam",
+			StreamUrl:     "https://t4.bcbits.com/stream/fixture2002/mp3-128/2002?p=0&ts=1700000000&t=fixture&token=1700000000_fixture",
+			Title:         "Slam",
+			PlaylistUrl:   "https://fixture.bandcamp.com/album/fixture-album",
+			PlaylistTitle: "Fixture Album",
+			Uploader:      "Fixture Band feat. Guest",
+			Duration:      251,
+			Expires:       expires,
+		},
+	})
+}
+
+func TestFixtureBandcampErrors(t *testing.T) {
+	cfg := fixture.Config(t)
+	cfg["youtube-dl"]["enabled"] = false
+
+	for _, c := range []struct {
+		url string
+		err error
+	}{
+		{"https://fixture.bandcamp.com/track/bonus-track", bandcamp.ErrTrackUnavailable},
+		{"https://fixture.bandcamp.com/track/not-a-track-page", bandcamp.ErrNoTralbumData},
+	} {
+		_, err := extractor.Extract(context.Background(), cfg, c.url)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v: expected error '%v' but got '%v'", c.url, c.err, err)
+		}
+	}
+}
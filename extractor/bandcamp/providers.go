@@ -0,0 +1,56 @@
+package bandcamp
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	extractor.AddExtractor("bandcamp", &Extractor{})
+}
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Only matches <artist>.bandcamp.com/track/<track> and
+// <artist>.bandcamp.com/album/<album>; artists with their own domain are left
+// to youtube-dl.
+func matches(input string) bool {
+	u, err := url.Parse(input)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if !strings.HasSuffix(u.Host, ".bandcamp.com") {
+		return false
+	}
+	sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(sp) != 2 || sp[1] == "" {
+		return false
+	}
+	return sp[0] == "track" || sp[0] == "album"
+}
+
+type Extractor struct{}
+
+func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{}
+}
+
+func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
+	return matches(input)
+}
+
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	if !matches(input) {
+		return nil, ErrInvalidInput
+	}
+	return getTralbumData(ctx, extractor.HttpClient(cfg), input)
+}
@@ -1,6 +1,10 @@
 package builtins
 
 import (
+	_ "git.nobrain.org/r4/dischord/extractor/applemusic"
+	_ "git.nobrain.org/r4/dischord/extractor/bandcamp"
+	_ "git.nobrain.org/r4/dischord/extractor/deezer"
+	_ "git.nobrain.org/r4/dischord/extractor/soundcloud"
 	_ "git.nobrain.org/r4/dischord/extractor/spotify"
 	_ "git.nobrain.org/r4/dischord/extractor/youtube"
 	_ "git.nobrain.org/r4/dischord/extractor/ytdl"
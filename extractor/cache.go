@@ -0,0 +1,160 @@
+package extractor
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The cache shared by all providers is configured like a provider of this
+// name. Providers get the resulting cache through ProviderCache().
+const CacheConfigName = "cache"
+
+// Key under which the cache is passed to providers.
+const cacheKey = "cache"
+
+func init() {
+	providers = append(providers, provider{cacheProvider{}, CacheConfigName})
+}
+
+type cacheProvider struct{}
+
+func (cacheProvider) DefaultConfig() ProviderConfig {
+	return ProviderConfig{
+		"enabled": true,
+		"dir":     "", // "dischord" in the user's cache directory if empty
+	}
+}
+
+// Lets providers keep state that's expensive to get (e.g. API tokens or
+// scripts they had to download) across restarts. Keys should start with the
+// provider's name.
+type Cache interface {
+	// Returns false if there's no entry for key or if it has expired.
+	Get(key string) ([]byte, bool)
+	// The entry is never removed if expires is the zero time.
+	Set(key string, value []byte, expires time.Time) error
+}
+
+// Caches are reused by their directory, so that providers running at the same
+// time don't step on each other's toes.
+var fileCaches sync.Map // string to Cache
+
+// Falls back to not caching anything if there's no cache directory.
+func (cfg Config) cache() Cache {
+	ccfg := cfg[CacheConfigName]
+	if c, ok := ccfg[cacheKey].(Cache); ok {
+		// See SetCache()
+		return c
+	}
+	if enabled, _ := ccfg["enabled"].(bool); !enabled {
+		return nopCache{}
+	}
+
+	dir, _ := ccfg["dir"].(string)
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nopCache{}
+		}
+		dir = filepath.Join(userDir, "dischord")
+	}
+	c, _ := fileCaches.LoadOrStore(dir, NewFileCache(dir))
+	return c.(Cache)
+}
+
+// Makes all providers use c instead of the cache from the cache settings,
+// e.g. to keep tests from touching the user's cache.
+func (cfg Config) SetCache(c Cache) {
+	if cfg[CacheConfigName] == nil {
+		cfg[CacheConfigName] = cacheProvider{}.DefaultConfig()
+	}
+	cfg[CacheConfigName][cacheKey] = c
+}
+
+// Returns the cache providers should keep their state in. It never fails, but
+// it may forget everything.
+func ProviderCache(cfg ProviderConfig) Cache {
+	if c, ok := cfg[cacheKey].(Cache); ok {
+		return c
+	}
+	return nopCache{}
+}
+
+type nopCache struct{}
+
+func (nopCache) Get(key string) ([]byte, bool)                         { return nil, false }
+func (nopCache) Set(key string, value []byte, expires time.Time) error { return nil }
+
+// Stores each entry in its own file in dir, which is created as needed. The
+// first line of a file is the expiry date (unix time; 0 for never), the rest
+// is the value.
+func NewFileCache(dir string) Cache {
+	return &fileCache{dir: dir}
+}
+
+type fileCache struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func (c *fileCache) filename(key string) string {
+	return filepath.Join(c.dir, url.PathEscape(key))
+}
+
+func (c *fileCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	filename := c.filename(key)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, false
+	}
+	expiry, value, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		os.Remove(filename)
+		return nil, false
+	}
+	expires, err := strconv.ParseInt(string(expiry), 10, 64)
+	if err != nil || (expires != 0 && time.Now().Unix() >= expires) {
+		os.Remove(filename)
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *fileCache) Set(key string, value []byte, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	var expiry int64
+	if !expires.IsZero() {
+		expiry = expires.Unix()
+	}
+
+	// Write to a temporary file first, so nobody ever reads half an entry
+	f, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%v\n%s", expiry, value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), c.filename(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
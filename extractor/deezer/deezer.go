@@ -0,0 +1,211 @@
+package deezer
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/match"
+	exutil "git.nobrain.org/r4/dischord/extractor/util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ErrApiRequestFailed    = errors.New("API request failed")
+	ErrDecodingApiResponse = errors.New("error decoding API response")
+	ErrInvalidTrackData    = errors.New("invalid track data")
+	ErrInvalidShareLink    = errors.New("share link doesn't lead to a Deezer link")
+)
+
+// Share links are sometimes redirected to other share links first, but never
+// this often
+const maxShareLinkRedirects = 5
+
+// The public API doesn't need any authentication
+const apiUrl = "https://api.deezer.com"
+
+// Errors are returned with status 200, so every response has to be checked
+// for this.
+type apiError struct {
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+// Makes a request to the API and decodes the JSON response into v.
+func apiGet(ctx context.Context, client *http.Client, reqUrl string, v any) error {
+	resp, err := exutil.HttpGet(ctx, client, reqUrl)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %v", ErrApiRequestFailed, resp.Status)
+	}
+
+	var raw json.RawMessage
+	var apiErr apiError
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return ErrDecodingApiResponse
+	}
+	if err := json.Unmarshal(raw, &apiErr); err != nil {
+		return ErrDecodingApiResponse
+	}
+	if apiErr.Error != nil {
+		return fmt.Errorf("%w: %v", ErrApiRequestFailed, apiErr.Error.Message)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return ErrDecodingApiResponse
+	}
+	return nil
+}
+
+// Returns the link a share link (see isShareLink()) redirects to. The link
+// itself isn't requested. Other links are returned unchanged.
+func resolveShareLink(ctx context.Context, client *http.Client, input string) (string, error) {
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	for i := 0; isShareLink(input); i++ {
+		if i == maxShareLinkRedirects {
+			return "", ErrInvalidShareLink
+		}
+		resp, err := exutil.HttpGet(ctx, &noRedirects, input)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		loc, err := resp.Location()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidShareLink, resp.Status)
+		}
+		input = loc.String()
+	}
+	return input, nil
+}
+
+type artistData struct {
+	Name string `json:"name"`
+}
+
+// Tracks in albums and playlists only have some of this.
+type trackData struct {
+	Title        string       `json:"title"`
+	Link         string       `json:"link"`
+	Duration     int          `json:"duration"` // in seconds
+	Isrc         string       `json:"isrc"`
+	ReleaseDate  string       `json:"release_date"` // e.g. "2010-02-25"
+	Artist       artistData   `json:"artist"`
+	Contributors []artistData `json:"contributors"`
+	Album        struct {
+		Title       string `json:"title"`
+		CoverMedium string `json:"cover_medium"`
+	} `json:"album"`
+}
+
+func (d trackData) year() int {
+	if len(d.ReleaseDate) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(d.ReleaseDate[:4])
+	return year
+}
+
+// Returns -1 if unknown.
+func (d trackData) duration() int {
+	if d.Duration <= 0 {
+		return -1
+	}
+	return d.Duration
+}
+
+func getTrack(ctx context.Context, client *http.Client, trackId string) (match.Track, error) {
+	var data trackData
+	if err := apiGet(ctx, client, apiUrl+"/track/"+trackId, &data); err != nil {
+		return match.Track{}, err
+	}
+	if data.Title == "" || data.Artist.Name == "" {
+		return match.Track{}, ErrInvalidTrackData
+	}
+
+	res := match.Track{
+		SourceUrl: data.Link,
+		Name:      data.Title,
+		Album:     data.Album.Title,
+		Year:      data.year(),
+		Thumbnail: data.Album.CoverMedium,
+		Duration:  data.duration(),
+		Isrc:      data.Isrc,
+	}
+	// Contributors include featured artists, main artist first
+	for _, v := range data.Contributors {
+		res.Artists = append(res.Artists, v.Name)
+	}
+	if len(res.Artists) == 0 {
+		res.Artists = []string{data.Artist.Name}
+	}
+	return res, nil
+}
+
+// Calls fn with each page of tracks of an album or playlist (given by kind).
+func getTrackListFunc(ctx context.Context, client *http.Client, kind, id string, fn func([]extractor.Data) error) error {
+	var data struct {
+		Title string `json:"title"`
+		Link  string `json:"link"`
+		// Albums only
+		CoverMedium string `json:"cover_medium"`
+		ReleaseDate string `json:"release_date"`
+	}
+	if err := apiGet(ctx, client, apiUrl+"/"+kind+"/"+id, &data); err != nil {
+		return err
+	}
+
+	reqUrl := apiUrl + "/" + kind + "/" + id + "/tracks"
+	for reqUrl != "" {
+		var tracks struct {
+			Data []trackData `json:"data"`
+			Next string      `json:"next"`
+		}
+		if err := apiGet(ctx, client, reqUrl, &tracks); err != nil {
+			return err
+		}
+		var res []extractor.Data
+		for _, v := range tracks.Data {
+			if kind == "album" {
+				// The album's tracks don't repeat the album
+				v.Album.Title = data.Title
+				v.Album.CoverMedium = data.CoverMedium
+				v.ReleaseDate = data.ReleaseDate
+			}
+			track := match.Track{
+				Name:    v.Title,
+				Artists: []string{v.Artist.Name},
+			}
+			res = append(res, extractor.Data{
+				SourceUrl:     v.Link,
+				Title:         track.TitleString(),
+				Uploader:      track.ArtistsString(),
+				Artist:        track.ArtistsString(),
+				Album:         v.Album.Title,
+				Year:          v.year(),
+				Thumbnail:     v.Album.CoverMedium,
+				Duration:      v.duration(),
+				PlaylistUrl:   data.Link,
+				PlaylistTitle: data.Title,
+			})
+		}
+		if len(res) > 0 {
+			if err := fn(res); err != nil {
+				return err
+			}
+		}
+		reqUrl = tracks.Next
+	}
+	return nil
+}
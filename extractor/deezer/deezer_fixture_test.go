@@ -0,0 +1,82 @@
+package deezer_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/deezer"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureDeezer(t *testing.T) {
+	cover := "https://e-cdns-images.dzcdn.net/images/cover/fixtureAlb1/250x250-000000-80-0-0.jpg"
+	for _, input := range []string{
+		"https://www.deezer.com/track/fixtureTrk1",
+		"https://www.deezer.com/de/track/fixtureTrk1",
+		"https://link.deezer.com/s/fixtureShr1",
+	} {
+		data, err := extractor.Extract(context.Background(), fixture.Config(t), input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		if len(data) == 1 {
+			fixture.CheckExpires(t, &data[0], 21540*time.Second)
+		}
+		// Found on YouTube by its ISRC, like Spotify tracks
+		fixture.CheckData(t, data, []extractor.Data{{
+			SourceUrl:       "https://www.deezer.com/track/fixtureTrk1",
+			StreamUrl:       "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-music&n=edcb&itag=251&sig=IHJFEDCBA",
+			Title:           "Infected Mushroom, Ninet Tayeb - Black Velvet",
+			Uploader:        "Infected Mushroom, Ninet Tayeb",
+			Artist:          "Infected Mushroom, Ninet Tayeb",
+			Album:           "Head of NASA and the 2 Amish Boys",
+			Year:            2010,
+			Thumbnail:       cover,
+			Duration:        212,
+			MatchConfidence: 1,
+		}})
+	}
+
+	album := fixture.Playlist{Url: "https://www.deezer.com/album/fixtureAlb1", Title: "Head of NASA and the 2 Amish Boys"}
+	for _, input := range []string{
+		"https://www.deezer.com/en/album/fixtureAlb1",
+		// Redirected to another share link first
+		"https://deezer.page.link/fixtureShr2",
+	} {
+		data, err := extractor.Extract(context.Background(), fixture.Config(t), input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		fixture.CheckData(t, data, []extractor.Data{
+			fixture.FromAlbum(album.Track("https://www.deezer.com/track/fixtureTrk1", "Infected Mushroom - Black Velvet", "Infected Mushroom", 260), album.Title, 2010, cover),
+			fixture.FromAlbum(album.Track("https://www.deezer.com/track/fixtureTrk3", "Infected Mushroom - Fields of Grey", "Infected Mushroom", 290), album.Title, 2010, cover),
+		})
+	}
+
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://deezer.com/playlist/fixturePls1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	pls := fixture.Playlist{Url: "https://www.deezer.com/playlist/fixturePls1", Title: "Fixture Playlist"}
+	// Only some playlist tracks have their album, and none the release date
+	fixture.CheckData(t, data, []extractor.Data{
+		fixture.FromAlbum(pls.Track("https://www.deezer.com/track/fixtureTrk1", "Infected Mushroom - Black Velvet", "Infected Mushroom", 260), album.Title, 0, cover),
+		pls.Track("https://www.deezer.com/track/fixtureTrk4", "Infected Mushroom - Bliss on Mushrooms", "Infected Mushroom", 432),
+	})
+
+	_, err = extractor.Extract(context.Background(), fixture.Config(t), "https://www.deezer.com/track/fixtureMissing")
+	if !errors.Is(err, deezer.ErrApiRequestFailed) {
+		t.Errorf("Expected error '%v' but got '%v'", deezer.ErrApiRequestFailed, err)
+	}
+
+	// A share link that doesn't lead to anything that could be played
+	_, err = extractor.Extract(context.Background(), fixture.Config(t), "https://link.deezer.com/s/fixtureShr4")
+	if !errors.Is(err, deezer.ErrInvalidInput) {
+		t.Errorf("Expected error '%v' but got '%v'", deezer.ErrInvalidInput, err)
+	}
+}
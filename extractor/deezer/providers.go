@@ -0,0 +1,170 @@
+package deezer
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/match"
+
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	extractor.AddExtractor("deezer", NewExtractor())
+}
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Only these are supported; the rest (e.g. artists) isn't something that
+// could be played
+var kinds = map[string]struct{}{
+	"track":    {},
+	"album":    {},
+	"playlist": {},
+}
+
+// Accepts links with or without a language, e.g.
+// https://www.deezer.com/de/track/<id>. Returns the kind of resource (e.g.
+// "track") and its ID.
+func matches(input string) (kind, id string, ok bool) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", "", false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", false
+	}
+	if u.Host != "www.deezer.com" && u.Host != "deezer.com" {
+		return "", "", false
+	}
+	sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(sp) == 3 {
+		// Language
+		sp = sp[1:]
+	}
+	if len(sp) != 2 || sp[1] == "" {
+		return "", "", false
+	}
+	if _, ok := kinds[sp[0]]; !ok {
+		return "", "", false
+	}
+	return sp[0], sp[1], true
+}
+
+// Share links (e.g. https://link.deezer.com/s/<id>) redirect to regular links
+// (see resolveShareLink()).
+func isShareLink(input string) bool {
+	u, err := url.Parse(input)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	switch u.Host {
+	case "link.deezer.com", "deezer.page.link":
+		return strings.Trim(u.Path, "/") != ""
+	}
+	return false
+}
+
+// Like matches(), but share links are resolved first.
+func resolve(ctx context.Context, client *http.Client, input string) (kind, id string, err error) {
+	input, err = resolveShareLink(ctx, client, input)
+	if err != nil {
+		return "", "", err
+	}
+	kind, id, ok := matches(input)
+	if !ok {
+		return "", "", ErrInvalidInput
+	}
+	return kind, id, nil
+}
+
+type Extractor struct {
+	matcher *match.Matcher
+}
+
+func NewExtractor() *Extractor {
+	return &Extractor{
+		matcher: match.NewMatcher("deezer"),
+	}
+}
+
+func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{}
+}
+
+func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
+	_, _, ok := matches(input)
+	return ok || isShareLink(input)
+}
+
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	var res []extractor.Data
+	err := e.ExtractFunc(ctx, cfg, input, func(data []extractor.Data) error {
+		res = append(res, data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Album and playlist tracks are passed on page by page, since playlists can
+// be very long.
+func (e *Extractor) ExtractFunc(ctx context.Context, cfg extractor.ProviderConfig, input string, fn func([]extractor.Data) error) error {
+	client := extractor.HttpClient(cfg)
+	kind, id, err := resolve(ctx, client, input)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "track":
+		track, err := getTrack(ctx, client, id)
+		if err != nil {
+			return err
+		}
+		d, err := e.matcher.Get(ctx, cfg, "track-"+id, track)
+		if err != nil {
+			return err
+		}
+		return fn([]extractor.Data{d})
+	case "album", "playlist":
+		return getTrackListFunc(ctx, client, kind, id, fn)
+	}
+	return ErrInvalidInput
+}
+
+// Tracks are played from YouTube videos
+func (e *Extractor) MatchCandidates(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	client := extractor.HttpClient(cfg)
+	kind, id, err := resolve(ctx, client, input)
+	if err != nil {
+		return nil, err
+	}
+	if kind != "track" {
+		return nil, extractor.ErrNotMatched
+	}
+	track, err := getTrack(ctx, client, id)
+	if err != nil {
+		return nil, err
+	}
+	return e.matcher.Candidates(ctx, cfg, track)
+}
+
+func (e *Extractor) FixMatch(ctx context.Context, cfg extractor.ProviderConfig, input, candidateUrl string) error {
+	kind, id, err := resolve(ctx, extractor.HttpClient(cfg), input)
+	if err != nil {
+		return err
+	}
+	if kind != "track" {
+		return extractor.ErrNotMatched
+	}
+	return e.matcher.Fix(ctx, cfg, "track-"+id, candidateUrl)
+}
@@ -1,9 +1,12 @@
 package extractor
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -11,6 +14,11 @@ var (
 	ErrNoSearchResults      = errors.New("no search results")
 	ErrNoSearchProvider     = errors.New("no search provider available")
 	ErrNoSuggestionProvider = errors.New("no search suggestion provider available")
+	ErrNotMatched           = errors.New("input isn't played from a stream found by searching")
+	// Providers wrap this for content that can't be played no matter which
+	// provider is used (e.g. because it's private or was removed), so no
+	// other provider is tried
+	ErrUnavailable = errors.New("content is unavailable")
 )
 
 var (
@@ -21,20 +29,44 @@ var (
 	defaultConfig Config
 )
 
-func Extract(cfg Config, input string) ([]Data, error) {
+// Providers are tried in the order of their priority (see providerOrder()).
+// If a provider fails, the next one is tried; if all of them fail, the first
+// error is returned. Extractors aren't tried anymore once one of them reports
+// that the content itself is unavailable (see ErrUnavailable).
+//
+// Extract, Search and Suggest give up as soon as ctx is done; use errors.Is()
+// to check for the context's error.
+func Extract(ctx context.Context, cfg Config, input string) ([]Data, error) {
 	if err := cfg.CheckValidity(); err != nil {
 		return nil, err
 	}
-	for _, e := range extractors {
-		if e.Matches(cfg[e.name], input) {
-			data, err := e.Extract(cfg[e.name], input)
-			if err != nil {
-				return nil, &Error{e.name, err}
-			}
+	var firstErr error
+	for _, e := range providerOrder(cfg, extractors, func(e extractor) string { return e.name }) {
+		if !e.Matches(cfg[e.name], input) {
+			continue
+		}
+		pcfg, err := cfg.providerConfig(e.name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := e.Extract(ctx, pcfg, input)
+		if err == nil {
 			return data, nil
 		}
+		if errors.Is(err, ErrUnavailable) {
+			return nil, &Error{e.name, err}
+		}
+		if firstErr == nil {
+			firstErr = &Error{e.name, err}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
 	}
-	d, err := Search(cfg, input)
+	d, err := Search(ctx, cfg, input)
 	if err != nil {
 		return nil, err
 	}
@@ -44,34 +76,273 @@ func Extract(cfg Config, input string) ([]Data, error) {
 	return []Data{d[0]}, nil
 }
 
-func Search(cfg Config, input string) ([]Data, error) {
+// Like Extract(), but calls fn with the results bit by bit as they come in
+// (e.g. page by page for long playlists), so they can be used before all of
+// them are there. Once an extractor has passed results to fn, the others
+// aren't tried anymore if it fails. If fn returns an error, extraction stops
+// and that error is returned.
+func ExtractFunc(ctx context.Context, cfg Config, input string, fn func([]Data) error) error {
 	if err := cfg.CheckValidity(); err != nil {
+		return err
+	}
+	var firstErr error
+	for _, e := range providerOrder(cfg, extractors, func(e extractor) string { return e.name }) {
+		if !e.Matches(cfg[e.name], input) {
+			continue
+		}
+		pcfg, err := cfg.providerConfig(e.name)
+		if err != nil {
+			return err
+		}
+		var fnErr error
+		called := false
+		if se, ok := e.Extractor.(StreamExtractor); ok {
+			err = se.ExtractFunc(ctx, pcfg, input, func(data []Data) error {
+				if len(data) == 0 {
+					return nil
+				}
+				called = true
+				fnErr = fn(data)
+				return fnErr
+			})
+		} else {
+			var data []Data
+			data, err = e.Extract(ctx, pcfg, input)
+			if err == nil {
+				called = true
+				fnErr = fn(data)
+			}
+		}
+		if fnErr != nil {
+			return fnErr
+		}
+		if err == nil {
+			return nil
+		}
+		if called || errors.Is(err, ErrUnavailable) {
+			return &Error{e.name, err}
+		}
+		if firstErr == nil {
+			firstErr = &Error{e.name, err}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	d, err := Search(ctx, cfg, input)
+	if err != nil {
+		return err
+	}
+	if len(d) == 0 {
+		return ErrNoSearchResults
+	}
+	return fn([]Data{d[0]})
+}
+
+// Returns the results input's stream is chosen from (see MatchingExtractor),
+// best first. Unlike Extract(), only the first extractor that matches input
+// and can match streams is tried.
+func MatchCandidates(ctx context.Context, cfg Config, input string) ([]Data, error) {
+	e, name, pcfg, err := matchingExtractor(cfg, input)
+	if err != nil {
 		return nil, err
 	}
-	for _, s := range searchers {
-		data, err := s.Search(cfg[s.name], input)
+	data, err := e.MatchCandidates(ctx, pcfg, input)
+	if err != nil {
+		return nil, &Error{name, err}
+	}
+	return data, nil
+}
+
+// Makes input play the stream of candidateUrl from now on (see
+// MatchingExtractor). This only affects extracting input; results that were
+// extracted before have to be extracted again to get the new stream.
+func FixMatch(ctx context.Context, cfg Config, input, candidateUrl string) error {
+	e, name, pcfg, err := matchingExtractor(cfg, input)
+	if err != nil {
+		return err
+	}
+	if err := e.FixMatch(ctx, pcfg, input, candidateUrl); err != nil {
+		return &Error{name, err}
+	}
+	return nil
+}
+
+func matchingExtractor(cfg Config, input string) (MatchingExtractor, string, ProviderConfig, error) {
+	if err := cfg.CheckValidity(); err != nil {
+		return nil, "", nil, err
+	}
+	for _, e := range providerOrder(cfg, extractors, func(e extractor) string { return e.name }) {
+		me, ok := e.Extractor.(MatchingExtractor)
+		if !ok || !e.Matches(cfg[e.name], input) {
+			continue
+		}
+		pcfg, err := cfg.providerConfig(e.name)
 		if err != nil {
-			return nil, &Error{s.name, err}
+			return nil, "", nil, err
 		}
-		return data, nil
+		return me, e.name, pcfg, nil
 	}
-	return nil, ErrNoSearchProvider
+	return nil, "", nil, ErrNotMatched
 }
 
-func Suggest(cfg Config, input string) ([]string, error) {
+// Searches with all enabled searchers at the same time. Their results are
+// interleaved (beginning with the searcher of the highest priority) and
+// duplicates are removed. Searchers that fail are left out; an error is only
+// returned if all of them fail. If ctx is done before all searchers are
+// finished, whatever results there are so far are returned.
+//
+// The input may start with a searcher's search prefix followed by a colon
+// (e.g. "yt: some video") to only use that searcher.
+func Search(ctx context.Context, cfg Config, input string) ([]Data, error) {
 	if err := cfg.CheckValidity(); err != nil {
 		return nil, err
 	}
-	for _, s := range suggestors {
-		data, err := s.Suggest(cfg[s.name], input)
+	ss := providerOrder(cfg, searchers, func(s searcher) string { return s.name })
+	if prefix, query, ok := cutSearchPrefix(cfg, input); ok {
+		input = query
+		var filtered []searcher
+		for _, s := range ss {
+			if cfg[s.name][searchPrefixKey].(string) == prefix {
+				filtered = append(filtered, s)
+			}
+		}
+		ss = filtered
+	}
+	if len(ss) == 0 {
+		return nil, ErrNoSearchProvider
+	}
+
+	type result struct {
+		data []Data
+		err  error
+	}
+	resChs := make([]chan result, len(ss))
+	for i, s := range ss {
+		pcfg, err := cfg.providerConfig(s.name)
 		if err != nil {
-			return nil, &Error{s.name, err}
+			return nil, err
 		}
-		return data, nil
+		resChs[i] = make(chan result, 1)
+		go func(s searcher, resCh chan<- result) {
+			data, err := s.Search(ctx, pcfg, input)
+			if err != nil {
+				err = &Error{s.name, err}
+			}
+			resCh <- result{data, err}
+		}(s, resChs[i])
+	}
+
+	results := make([][]Data, len(ss))
+	var firstErr error
+	for i := range ss {
+		var res result
+		select {
+		case res = <-resChs[i]:
+		case <-ctx.Done():
+			select {
+			case res = <-resChs[i]:
+			default:
+				// Searchers which aren't done by now have failed
+				res.err = ctx.Err()
+			}
+		}
+		results[i] = res.data
+		if firstErr == nil {
+			firstErr = res.err
+		}
+	}
+
+	var res []Data
+	seen := make(map[string]struct{})
+	for i := 0; ; i++ {
+		added := false
+		for _, data := range results {
+			if i >= len(data) {
+				continue
+			}
+			added = true
+			key := data[i].SourceUrl
+			if key == "" {
+				key = data[i].PlaylistUrl
+			}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			res = append(res, data[i])
+		}
+		if !added {
+			break
+		}
+	}
+	if len(res) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return res, nil
+}
+
+// Splits a search prefix (see Search()) off the input, if it has one which
+// belongs to a searcher (even a disabled one).
+func cutSearchPrefix(cfg Config, input string) (prefix, query string, ok bool) {
+	i := strings.Index(input, ":")
+	if i == -1 {
+		return "", input, false
+	}
+	prefix = strings.ToLower(strings.TrimSpace(input[:i]))
+	for _, s := range searchers {
+		if p := cfg[s.name][searchPrefixKey].(string); p != "" && p == prefix {
+			return prefix, strings.TrimSpace(input[i+1:]), true
+		}
+	}
+	return "", input, false
+}
+
+func Suggest(ctx context.Context, cfg Config, input string) ([]string, error) {
+	if err := cfg.CheckValidity(); err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, s := range providerOrder(cfg, suggestors, func(s suggestor) string { return s.name }) {
+		pcfg, err := cfg.providerConfig(s.name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := s.Suggest(ctx, pcfg, input)
+		if err == nil {
+			return data, nil
+		}
+		if firstErr == nil {
+			firstErr = &Error{s.name, err}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
 	}
 	return nil, ErrNoSuggestionProvider
 }
 
+// Returns the enabled providers out of ps, sorted by their priority (highest
+// first). Providers with the same priority stay in the order they were added.
+func providerOrder[T any](cfg Config, ps []T, name func(T) string) []T {
+	var res []T
+	for _, p := range ps {
+		if cfg.Enabled(name(p)) {
+			res = append(res, p)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return cfg[name(res[i])][priorityKey].(int64) > cfg[name(res[j])][priorityKey].(int64)
+	})
+	return res
+}
+
 type Error struct {
 	ProviderName string
 	Err          error
@@ -81,6 +352,10 @@ func (e *Error) Error() string {
 	return "extractor[" + e.ProviderName + "]: " + e.Err.Error()
 }
 
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
 type provider struct {
 	Provider
 	name string
@@ -103,11 +378,36 @@ type suggestor struct {
 
 type Config map[string]ProviderConfig
 
+// Keys every extractor, searcher and suggestor has in its configuration, in
+// addition to its own ones. Providers may set their own defaults for them in
+// DefaultConfig().
+const (
+	enabledKey  = "enabled"
+	priorityKey = "priority" // int64; higher is tried first
+	// Searchers only; lets users restrict a search to the searcher (see
+	// Search())
+	searchPrefixKey = "search-prefix"
+)
+
 func DefaultConfig() Config {
 	if defaultConfig == nil {
 		cfg := make(Config)
 		for _, e := range providers {
-			cfg[e.name] = e.DefaultConfig()
+			pcfg := e.DefaultConfig()
+			if e.name != HttpConfigName && e.name != CacheConfigName {
+				if _, ok := pcfg[enabledKey]; !ok {
+					pcfg[enabledKey] = true
+				}
+				if _, ok := pcfg[priorityKey]; !ok {
+					pcfg[priorityKey] = int64(0)
+				}
+				if _, ok := e.Provider.(Searcher); ok {
+					if _, ok := pcfg[searchPrefixKey]; !ok {
+						pcfg[searchPrefixKey] = ""
+					}
+				}
+			}
+			cfg[e.name] = pcfg
 		}
 		return cfg
 	} else {
@@ -132,9 +432,33 @@ func (cfg Config) CheckValidity() error {
 			}
 		}
 	}
+	if _, err := cfg.httpClient(); err != nil {
+		return fmt.Errorf("invalid extractor configuration: %v: %w", HttpConfigName, err)
+	}
 	return nil
 }
 
+// Reports whether the given provider is enabled.
+func (cfg Config) Enabled(name string) bool {
+	enabled, _ := cfg[name][enabledKey].(bool)
+	return enabled
+}
+
+// Adds the default values of any providers or keys missing from cfg, e.g.
+// because they were added after the config file was written.
+func (cfg Config) FillDefaults() {
+	for name, defaults := range DefaultConfig() {
+		if cfg[name] == nil {
+			cfg[name] = make(ProviderConfig, len(defaults))
+		}
+		for k, v := range defaults {
+			if _, ok := cfg[name][k]; !ok {
+				cfg[name][k] = v
+			}
+		}
+	}
+}
+
 type ConfigTypeError struct {
 	Provider string
 	Key      string
@@ -163,7 +487,29 @@ type Provider interface {
 type Extractor interface {
 	Provider
 	Matches(cfg ProviderConfig, input string) bool
-	Extract(cfg ProviderConfig, input string) ([]Data, error)
+	Extract(ctx context.Context, cfg ProviderConfig, input string) ([]Data, error)
+}
+
+// Extractors which can pass on their results bit by bit (see ExtractFunc())
+// implement this in addition to Extractor.
+type StreamExtractor interface {
+	Extractor
+	// Calls fn with each batch of results as soon as it's there. Must stop
+	// and return fn's error if it returns one.
+	ExtractFunc(ctx context.Context, cfg ProviderConfig, input string, fn func([]Data) error) error
+}
+
+// Extractors which play streams they find by searching another site for the
+// metadata (e.g. Spotify tracks played from YouTube) implement this in
+// addition to Extractor, so that wrong matches can be fixed by hand.
+type MatchingExtractor interface {
+	Extractor
+	// Returns the search results the stream for input is chosen from, best
+	// first, with their MatchConfidence set.
+	MatchCandidates(ctx context.Context, cfg ProviderConfig, input string) ([]Data, error)
+	// Makes input play the stream of candidateUrl (usually the SourceUrl of
+	// one of the candidates) from now on.
+	FixMatch(ctx context.Context, cfg ProviderConfig, input, candidateUrl string) error
 }
 
 func AddExtractor(name string, e Extractor) {
@@ -173,7 +519,9 @@ func AddExtractor(name string, e Extractor) {
 
 type Searcher interface {
 	Provider
-	Search(cfg ProviderConfig, input string) ([]Data, error)
+	// Results have to have their Source set, since results from different
+	// searchers are shown together.
+	Search(ctx context.Context, cfg ProviderConfig, input string) ([]Data, error)
 }
 
 func AddSearcher(name string, s Searcher) {
@@ -183,7 +531,7 @@ func AddSearcher(name string, s Searcher) {
 
 type Suggestor interface {
 	Provider
-	Suggest(cfg ProviderConfig, input string) ([]string, error)
+	Suggest(ctx context.Context, cfg ProviderConfig, input string) ([]string, error)
 }
 
 func AddSuggestor(name string, s Suggestor) {
@@ -195,14 +543,24 @@ type Data struct {
 	// Each instance of this struct should be reconstructable by calling
 	// Extract() on the SourceUrl
 	// String values are "" if not present
-	SourceUrl      string
-	StreamUrl      string // may expire, see Expires
-	Title          string
-	PlaylistUrl    string
-	PlaylistTitle  string
-	Description    string
-	Uploader       string
-	Duration       int       // in seconds; -1 if unknown
-	Expires        time.Time // when StreamUrl expires
-	OfficialArtist bool      // only for sites that have non-music (e.g. YouTube); search results only
+	SourceUrl       string
+	StreamUrl       string // may expire, see Expires
+	Title           string
+	PlaylistUrl     string
+	PlaylistTitle   string
+	Description     string
+	Uploader        string
+	Artist          string // who performs it, unlike Uploader (e.g. a label or a user who reuploaded the song)
+	Album           string
+	Year            int       // release year (or upload year if that's all there is); 0 if unknown
+	Thumbnail       string    // image URL
+	Views           int64     // 0 if unknown
+	IsLive          bool      // whether it's a live stream that's currently going on
+	Duration        int       // in seconds; -1 if unknown
+	Expires         time.Time // when StreamUrl expires
+	StartOffset     int       // in seconds; where playback should start (e.g. from a timestamp in the URL)
+	OfficialArtist  bool      // only for sites that have non-music (e.g. YouTube); search results only
+	Source          string    // name of the site the result is from, e.g. "YouTube"; search results only
+	Unavailable     bool      // playlist entries only; can't be played (e.g. deleted or private videos), only returned so they can be counted
+	MatchConfidence float64   // only if the stream was found by searching another site for the metadata (e.g. Spotify tracks are played from YouTube); how likely it is to be the right one, from 0 to 1; 0 if not applicable
 }
@@ -0,0 +1,355 @@
+package extractor_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/youtube"
+
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureFallback(t *testing.T) {
+	fixture.SkipWithoutShell(t)
+
+	// youtube-dl takes over if the YouTube extractor fails
+	cfg := fixture.Config(t)
+	data, err := extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixtureBrk1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 1 || data[0].Title != "Fixture Video (youtube-dl)" {
+		t.Fatalf("Expected the result of youtube-dl but got %+v", data)
+	}
+
+	// If both fail, the YouTube extractor's error is returned
+	_, err = extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixtureSil1")
+	if !errors.Is(err, youtube.ErrNoSuitableFormat) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrNoSuitableFormat, err)
+	}
+
+	// youtube-dl isn't tried for videos that can't be played anyway (even
+	// though the fake one would return something)
+	_, err = extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixturePriv")
+	if !errors.Is(err, youtube.ErrVideoPrivate) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrVideoPrivate, err)
+	}
+
+	// Preferring youtube-dl, or disabling the YouTube extractor
+	for _, change := range []func(cfg extractor.Config){
+		func(cfg extractor.Config) { cfg["youtube-dl"]["priority"] = int64(10) },
+		func(cfg extractor.Config) { cfg["youtube"]["enabled"] = false },
+	} {
+		cfg := fixture.Config(t)
+		change(cfg)
+		data, err := extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixtureVid1")
+		if err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+		if len(data) != 1 || data[0].Title != "Fixture Video (youtube-dl)" {
+			t.Fatalf("Expected the result of youtube-dl but got %+v", data)
+		}
+	}
+}
+
+func TestFixtureExtractFunc(t *testing.T) {
+	cfg := fixture.Config(t)
+	pUrl := "https://www.youtube.com/playlist?list=PLfixture"
+	expected, err := extractor.Extract(context.Background(), cfg, pUrl)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+
+	// Each page of the playlist is passed on by itself
+	var batches [][]extractor.Data
+	err = extractor.ExtractFunc(context.Background(), cfg, pUrl, func(data []extractor.Data) error {
+		batches = append(batches, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("Expected 2 batches but got %v", len(batches))
+	}
+	fixture.CheckData(t, append(batches[0], batches[1]...), expected)
+
+	// Nothing else is loaded once fn fails
+	errStop := errors.New("stop")
+	calls := 0
+	err = extractor.ExtractFunc(context.Background(), cfg, pUrl, func(data []extractor.Data) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Fatalf("Expected error '%v' after 1 call but got '%v' after %v", errStop, err, calls)
+	}
+
+	// Search results
+	calls = 0
+	err = extractor.ExtractFunc(context.Background(), cfg, "black velvet", func(data []extractor.Data) error {
+		calls++
+		if len(data) != 1 || data[0].SourceUrl != "https://www.youtube.com/watch?v=fixtureCov1" {
+			t.Errorf("Expected only the first search result but got %+v", data)
+		}
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Fatalf("Expected no error after 1 call but got '%v' after %v", err, calls)
+	}
+}
+
+func TestFixtureSearch(t *testing.T) {
+	yt := []extractor.Data{
+		{
+			SourceUrl: "https://www.youtube.com/watch?v=fixtureCov1",
+			Title:     "Black Velvet (Guitar Cover)",
+			Uploader:  "Some Guitarist",
+			Thumbnail: fixture.YoutubeThumbnail("fixtureCov1"),
+			Duration:  261,
+			Source:    "YouTube",
+		},
+		{
+			SourceUrl: "https://www.youtube.com/watch?v=fixtureMus1",
+			Title:     "Infected Mushroom feat. Ninet Tayeb - Black Velvet",
+			Uploader:  "Infected Mushroom - Topic",
+			Artist:    "Infected Mushroom",
+			Thumbnail: fixture.YoutubeThumbnail("fixtureMus1"),
+			Duration:  260,
+			Source:    "YouTube",
+		},
+		{
+			PlaylistUrl:   "https://www.youtube.com/playlist?list=PLfixture",
+			PlaylistTitle: "Fixture Playlist",
+			Source:        "YouTube",
+		},
+		{
+			SourceUrl:      "https://www.youtube.com/watch?v=fixtureLiv1",
+			Title:          "Infected Mushroom - Black Velvet (Live)",
+			Uploader:       "Infected Mushroom",
+			Thumbnail:      fixture.YoutubeThumbnail("fixtureLiv1"),
+			Duration:       468,
+			OfficialArtist: true,
+			Source:         "YouTube",
+		},
+	}
+	// The first song is also among the YouTube results
+	ytm := []extractor.Data{
+		{
+			SourceUrl:      "https://www.youtube.com/watch?v=fixtureMus1",
+			Title:          "Black Velvet",
+			Uploader:       "Infected Mushroom & Ninet Tayeb",
+			Artist:         "Infected Mushroom & Ninet Tayeb",
+			Album:          "Head of NASA and the 2 Amish Boys",
+			Thumbnail:      fixture.YoutubeThumbnail("fixtureMus1"),
+			Duration:       260,
+			OfficialArtist: true,
+			Source:         "YouTube Music",
+		},
+		{
+			SourceUrl:      "https://www.youtube.com/watch?v=fixtureRmx1",
+			Title:          "Black Velvet (Remix)",
+			Uploader:       "Infected Mushroom",
+			Artist:         "Infected Mushroom",
+			Album:          "Black Velvet (Remixes)",
+			Thumbnail:      fixture.YoutubeThumbnail("fixtureRmx1"),
+			Duration:       301,
+			OfficialArtist: true,
+			Source:         "YouTube Music",
+		},
+	}
+	sc := []extractor.Data{
+		{
+			SourceUrl: "https://soundcloud.com/fixture-band/black-velvet",
+			Title:     "Black Velvet",
+			Uploader:  "Fixture Band",
+			Duration:  125,
+			Source:    "SoundCloud",
+		},
+		{
+			PlaylistUrl:   "https://soundcloud.com/fixture-band/sets/black-velvet-remixes",
+			PlaylistTitle: "Black Velvet Remixes",
+			Source:        "SoundCloud",
+		},
+		{
+			SourceUrl: "https://soundcloud.com/dj-fixture/black-velvet-remix",
+			Title:     "Black Velvet (Remix)",
+			Uploader:  "DJ Fixture",
+			Duration:  300,
+			Source:    "SoundCloud",
+		},
+	}
+
+	// Results of all searchers are interleaved, beginning with the one with
+	// the highest priority
+	cfg := fixture.Config(t)
+	data, err := extractor.Search(context.Background(), cfg, "black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, []extractor.Data{yt[0], ytm[0], sc[0], ytm[1], sc[1], yt[2], sc[2], yt[3]})
+
+	// Search prefixes
+	for _, test := range []struct {
+		input    string
+		expected []extractor.Data
+	}{
+		{"yt: black velvet", yt},
+		{"ytm: black velvet", ytm},
+		{"SC:black velvet", sc},
+	} {
+		data, err := extractor.Search(context.Background(), cfg, test.input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", test.input, err)
+		}
+		fixture.CheckData(t, data, test.expected)
+	}
+
+	// Anything that isn't a URL is searched for, and only the first result
+	// is returned
+	data, err = extractor.Extract(context.Background(), cfg, "black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, yt[:1])
+	data, err = extractor.Extract(context.Background(), cfg, "sc: black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, sc[:1])
+
+	// Both YouTube searchers fail and SoundCloud doesn't find anything
+	_, err = extractor.Search(context.Background(), cfg, "malformed")
+	if !errors.Is(err, youtube.ErrMalformedJson) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrMalformedJson, err)
+	}
+
+	// YouTube Music and SoundCloud don't respond in time
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	data, err = extractor.Search(ctx, cfg, "hang")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 4 || data[0].Source != "YouTube" {
+		t.Fatalf("Expected only the YouTube results but got %+v", data)
+	}
+
+	cfg["soundcloud-search"]["enabled"] = false
+	_, err = extractor.Search(context.Background(), cfg, "sc: black velvet")
+	if err != extractor.ErrNoSearchProvider {
+		t.Fatalf("Expected error '%v' but got '%v'", extractor.ErrNoSearchProvider, err)
+	}
+}
+
+var errFailingSearcher = errors.New("failing searcher always fails")
+
+// Registered below; disabled by default so it doesn't get in the way of the
+// other tests.
+type failingSearcher struct{}
+
+func (failingSearcher) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{
+		"enabled":  false,
+		"priority": int64(100),
+	}
+}
+
+func (failingSearcher) Search(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	return nil, errFailingSearcher
+}
+
+func init() {
+	extractor.AddSearcher("failing-search", failingSearcher{})
+}
+
+func TestFixtureSearchFallback(t *testing.T) {
+	cfg := fixture.Config(t)
+	cfg["failing-search"]["enabled"] = true
+	cfg["youtube-music-search"]["enabled"] = false
+	cfg["soundcloud-search"]["enabled"] = false
+	data, err := extractor.Search(context.Background(), cfg, "black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 4 {
+		t.Fatalf("Expected the results of the YouTube searcher but got %+v", data)
+	}
+
+	cfg["youtube-search"]["enabled"] = false
+	_, err = extractor.Search(context.Background(), cfg, "black velvet")
+	if !errors.Is(err, errFailingSearcher) {
+		t.Fatalf("Expected error '%v' but got '%v'", errFailingSearcher, err)
+	}
+
+	cfg["failing-search"]["enabled"] = false
+	_, err = extractor.Search(context.Background(), cfg, "black velvet")
+	if err != extractor.ErrNoSearchProvider {
+		t.Fatalf("Expected error '%v' but got '%v'", extractor.ErrNoSearchProvider, err)
+	}
+}
+
+func TestFixtureSearchSuggestions(t *testing.T) {
+	cfg := fixture.Config(t)
+	sug, err := extractor.Suggest(context.Background(), cfg, "black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected := []string{"black velvet", "black velvet infected mushroom", "black velvet lyrics"}
+	if strings.Join(sug, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Invalid suggestions: expected %q but got %q", expected, sug)
+	}
+
+	// SoundCloud takes over, but doesn't have anything
+	sug, err = extractor.Suggest(context.Background(), cfg, "malformed")
+	if err != nil || len(sug) != 0 {
+		t.Fatalf("Expected no suggestions but got %q, %v", sug, err)
+	}
+
+	cfg["soundcloud-search-suggestions"]["enabled"] = false
+	_, err = extractor.Suggest(context.Background(), cfg, "malformed")
+	if !errors.Is(err, youtube.ErrMalformedJson) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrMalformedJson, err)
+	}
+
+	cfg["soundcloud-search-suggestions"]["enabled"] = true
+	cfg["youtube-search-suggestions"]["enabled"] = false
+	sug, err = extractor.Suggest(context.Background(), cfg, "black velvet")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected = []string{"black velvet", "black velvet remix"}
+	if strings.Join(sug, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Invalid suggestions: expected %q but got %q", expected, sug)
+	}
+}
+
+func TestFixtureCache(t *testing.T) {
+	cache := extractor.NewFileCache(t.TempDir())
+	if _, ok := cache.Get("missing"); ok {
+		t.Errorf("Got an entry that was never set")
+	}
+	for _, test := range []struct {
+		key     string
+		expires time.Time
+		found   bool
+	}{
+		{"forever", time.Time{}, true},
+		{"future/with/slashes", time.Now().Add(time.Hour), true},
+		{"expired", time.Now().Add(-time.Hour), false},
+	} {
+		if err := cache.Set(test.key, []byte("value\nof "+test.key), test.expires); err != nil {
+			t.Fatalf("%v: Error: %v", test.key, err)
+		}
+		value, ok := cache.Get(test.key)
+		if ok != test.found || (ok && string(value) != "value\nof "+test.key) {
+			t.Errorf("%v: expected found=%v but got '%s', %v", test.key, test.found, value, ok)
+		}
+	}
+
+}
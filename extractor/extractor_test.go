@@ -1,9 +1,15 @@
+//go:build live
+
+// These tests use the actual websites, so they need network access and break
+// whenever a site changes. Run them with "go test -tags live".
+
 package extractor_test
 
 import (
 	"git.nobrain.org/r4/dischord/extractor"
 	_ "git.nobrain.org/r4/dischord/extractor/builtins"
 
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -46,7 +52,7 @@ func verifySearchResult(t *testing.T, data []extractor.Data, targetUrl string) {
 	if first.SourceUrl != targetUrl {
 		t.Fatalf("Invalid search result: expected '%v' but got '%v'", targetUrl, first.SourceUrl)
 	}
-	strmData, err := extractor.Extract(extractorTestCfg, first.SourceUrl)
+	strmData, err := extractor.Extract(context.Background(), extractorTestCfg, first.SourceUrl)
 	if err != nil {
 		t.Fatalf("Error retrieving video data: %v", err)
 	}
@@ -59,9 +65,9 @@ func verifySearchResult(t *testing.T, data []extractor.Data, targetUrl string) {
 }
 
 func TestSearch(t *testing.T) {
-	extractor.Extract(extractorTestCfg, "https://open.spotify.com/track/22z9GL53FudbuFJqa43Nzj")
+	extractor.Extract(context.Background(), extractorTestCfg, "https://open.spotify.com/track/22z9GL53FudbuFJqa43Nzj")
 
-	data, err := extractor.Search(extractorTestCfg, "nilered turns water into wine like jesus")
+	data, err := extractor.Search(context.Background(), extractorTestCfg, "nilered turns water into wine like jesus")
 	if err != nil {
 		t.Fatalf("Error searching YouTube: %v", err)
 	}
@@ -69,7 +75,7 @@ func TestSearch(t *testing.T) {
 }
 
 func TestSearchPlaylist(t *testing.T) {
-	data, err := extractor.Search(extractorTestCfg, "instant regret clicking this playlist epic donut dude")
+	data, err := extractor.Search(context.Background(), extractorTestCfg, "instant regret clicking this playlist epic donut dude")
 	if err != nil {
 		t.Fatalf("Error searching YouTube: %v", err)
 	}
@@ -83,7 +89,7 @@ func TestSearchPlaylist(t *testing.T) {
 }
 
 func TestSearchSuggestions(t *testing.T) {
-	sug, err := extractor.Suggest(extractorTestCfg, "a")
+	sug, err := extractor.Suggest(context.Background(), extractorTestCfg, "a")
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -93,7 +99,7 @@ func TestSearchSuggestions(t *testing.T) {
 }
 
 func TestSearchIntegrityWeirdCharacters(t *testing.T) {
-	data, err := extractor.Extract(extractorTestCfg, "test lol | # !@#%&(*)!&*!äöfáßö®©œæ %% %3 %32")
+	data, err := extractor.Extract(context.Background(), extractorTestCfg, "test lol | # !@#%&(*)!&*!äöfáßö®©œæ %% %3 %32")
 	if err != nil {
 		t.Fatalf("Error searching YouTube: %v", err)
 	}
@@ -103,7 +109,7 @@ func TestSearchIntegrityWeirdCharacters(t *testing.T) {
 }
 
 func TestYoutubeMusicVideo(t *testing.T) {
-	data, err := extractor.Extract(extractorTestCfg, "https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	data, err := extractor.Extract(context.Background(), extractorTestCfg, "https://www.youtube.com/watch?v=dQw4w9WgXcQ")
 	if err != nil {
 		t.Fatalf("Error searching YouTube: %v", err)
 	}
@@ -128,7 +134,7 @@ func TestYoutubePlaylist(t *testing.T) {
 	url := "https://www.youtube.com/watch?v=jdUXfsMTv7o&list=PLdImBTpIvHA1xN1Dfw2Ec5NQ5d-LF3ZP5"
 	pUrl := "https://www.youtube.com/playlist?list=PLdImBTpIvHA1xN1Dfw2Ec5NQ5d-LF3ZP5"
 
-	data, err := extractor.Extract(cfg, url)
+	data, err := extractor.Extract(context.Background(), cfg, url)
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -139,7 +145,7 @@ func TestYoutubePlaylist(t *testing.T) {
 		t.Fatalf("Did not expect a playlist")
 	}
 
-	data, err = extractor.Extract(cfg, pUrl)
+	data, err = extractor.Extract(context.Background(), cfg, pUrl)
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -147,7 +153,7 @@ func TestYoutubePlaylist(t *testing.T) {
 		t.Fatalf("Invalid playlist item count: got '%v'", len(data))
 	}
 
-	data, err = extractor.Extract(extractorTestCfg, url)
+	data, err = extractor.Extract(context.Background(), extractorTestCfg, url)
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -163,7 +169,7 @@ func TestYoutubePlaylist(t *testing.T) {
 }
 
 func TestSpotifyTrack(t *testing.T) {
-	data, err := extractor.Extract(extractorTestCfg, "https://open.spotify.com/track/7HjaeqTHY6QlwPY0MEjuMF")
+	data, err := extractor.Extract(context.Background(), extractorTestCfg, "https://open.spotify.com/track/7HjaeqTHY6QlwPY0MEjuMF")
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -182,7 +188,7 @@ func TestSpotifyTrack(t *testing.T) {
 }
 
 func TestSpotifyAlbum(t *testing.T) {
-	data, err := extractor.Extract(extractorTestCfg, "https://open.spotify.com/album/6YEjK95sgoXQn1yGbYjHsp")
+	data, err := extractor.Extract(context.Background(), extractorTestCfg, "https://open.spotify.com/album/6YEjK95sgoXQn1yGbYjHsp")
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -201,7 +207,7 @@ func TestSpotifyAlbum(t *testing.T) {
 }
 
 func TestYoutubeDl(t *testing.T) {
-	data, err := extractor.Extract(extractorTestCfg, "https://soundcloud.com/pendulum/sets/hold-your-colour-1")
+	data, err := extractor.Extract(context.Background(), extractorTestCfg, "https://soundcloud.com/pendulum/sets/hold-your-colour-1")
 	if err != nil {
 		t.Fatalf("Error: %v", err)
 	}
@@ -0,0 +1,269 @@
+package extractor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCookieFile = errors.New("invalid Netscape cookie file")
+)
+
+// The HTTP settings shared by all providers are configured like a provider of
+// this name. Providers get the resulting client through HttpClient().
+const HttpConfigName = "http"
+
+// Keys under which the HTTP client and settings are passed to providers.
+const (
+	httpClientKey   = "http-client"
+	httpSettingsKey = "http-settings"
+)
+
+func init() {
+	providers = append(providers, provider{httpProvider{}, HttpConfigName})
+}
+
+type httpProvider struct{}
+
+func (httpProvider) DefaultConfig() ProviderConfig {
+	return ProviderConfig{
+		"proxy":            "", // e.g. "socks5://localhost:1080"; uses the environment's proxy if empty; also used for streams, but only HTTP proxies work when transcoding
+		"user-agent":       "", // Go's default if empty
+		"cookie-file":      "", // Netscape format, as exported by most browser extensions
+		"timeout-seconds":  int64(30),
+		"retries":          int64(2),
+		"retry-backoff-ms": int64(500), // doubled with every retry
+	}
+}
+
+// Clients are cached by their settings (and the cookie file's modification
+// time), mostly to avoid parsing the cookie file over and over again.
+var httpClients sync.Map // string to *http.Client
+
+func (cfg Config) httpClient() (*http.Client, error) {
+	hcfg := cfg[HttpConfigName]
+	if c, ok := hcfg[httpClientKey].(*http.Client); ok {
+		// See SetHttpClient()
+		return c, nil
+	}
+
+	key := fmt.Sprint(map[string]any(hcfg))
+	if cookieFile := hcfg["cookie-file"].(string); cookieFile != "" {
+		// Reload the cookies if the file changed
+		if fi, err := os.Stat(cookieFile); err == nil {
+			key += " " + fi.ModTime().String()
+		}
+	}
+	if c, ok := httpClients.Load(key); ok {
+		return c.(*http.Client), nil
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := hcfg["proxy"].(string); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		tr.Proxy = http.ProxyURL(u)
+	}
+
+	c := &http.Client{
+		Transport: &retryTransport{
+			base:      tr,
+			userAgent: hcfg["user-agent"].(string),
+			retries:   int(hcfg["retries"].(int64)),
+			backoff:   time.Duration(hcfg["retry-backoff-ms"].(int64)) * time.Millisecond,
+		},
+		Timeout: time.Duration(hcfg["timeout-seconds"].(int64)) * time.Second,
+	}
+
+	if cookieFile := hcfg["cookie-file"].(string); cookieFile != "" {
+		jar, err := loadNetscapeCookieFile(cookieFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Jar = jar
+	}
+
+	httpClients.Store(key, c)
+	return c, nil
+}
+
+// Returns the configured proxy, if any. Streams have to be downloaded through
+// the same proxy they were extracted through, since some sites (e.g. YouTube)
+// only serve them to the IP address they were requested from.
+func (cfg Config) HttpProxy() string {
+	proxy, _ := cfg[HttpConfigName]["proxy"].(string)
+	return proxy
+}
+
+// Makes all providers use c instead of a client built from the HTTP settings,
+// e.g. to serve recorded responses in tests.
+func (cfg Config) SetHttpClient(c *http.Client) {
+	if cfg[HttpConfigName] == nil {
+		cfg[HttpConfigName] = httpProvider{}.DefaultConfig()
+	}
+	cfg[HttpConfigName][httpClientKey] = c
+}
+
+// Returns the configuration passed to the given provider, which includes the
+// shared HTTP client and cache.
+func (cfg Config) providerConfig(name string) (ProviderConfig, error) {
+	c, err := cfg.httpClient()
+	if err != nil {
+		return nil, &Error{HttpConfigName, err}
+	}
+	res := make(ProviderConfig, len(cfg[name])+3)
+	for k, v := range cfg[name] {
+		res[k] = v
+	}
+	res[httpClientKey] = c
+	res[httpSettingsKey] = cfg[HttpConfigName]
+	res[cacheKey] = cfg.cache()
+	return res, nil
+}
+
+// Returns the HTTP client providers should use for all their requests.
+func HttpClient(cfg ProviderConfig) *http.Client {
+	if c, ok := cfg[httpClientKey].(*http.Client); ok {
+		return c
+	}
+	return http.DefaultClient
+}
+
+// Returns the raw HTTP settings (see httpProvider.DefaultConfig()), for
+// providers which need to pass them on to external programs.
+func HttpSettings(cfg ProviderConfig) ProviderConfig {
+	if s, ok := cfg[httpSettingsKey].(ProviderConfig); ok {
+		return s
+	}
+	return httpProvider{}.DefaultConfig()
+}
+
+// Returns a copy of dst with the HTTP client and settings (and the cache) of
+// src. Useful for providers which use other providers internally.
+func WithHttp(dst, src ProviderConfig) ProviderConfig {
+	res := make(ProviderConfig, len(dst)+3)
+	for k, v := range dst {
+		res[k] = v
+	}
+	for _, k := range []string{httpClientKey, httpSettingsKey, cacheKey} {
+		if v, ok := src[k]; ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Sets the User-Agent header and retries failed requests with an
+// exponential backoff.
+type retryTransport struct {
+	base      http.RoundTripper
+	userAgent string
+	retries   int
+	backoff   time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+
+	// Requests with a body might not be safe to repeat
+	canRetry := req.Body == nil && (req.Method == "GET" || req.Method == "HEAD")
+
+	backoff := t.backoff
+	for try := 0; ; try++ {
+		resp, err := t.base.RoundTrip(req)
+		failed := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !failed || !canRetry || try >= t.retries {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Loads cookies from a file in the Netscape format used by curl, youtube-dl
+// and most cookie export browser extensions. Each line consists of the tab
+// separated fields domain, include subdomains, path, secure, expiry (unix
+// time), name and value.
+func loadNetscapeCookieFile(filename string) (http.CookieJar, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := bufio.NewScanner(f)
+	for lineNum := 1; sc.Scan(); lineNum++ {
+		line := strings.TrimSpace(sc.Text())
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("%v:%v: %w", filename, lineNum, ErrInvalidCookieFile)
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", filename, lineNum, ErrInvalidCookieFile)
+		}
+
+		host := strings.TrimPrefix(fields[0], ".")
+		cookie := &http.Cookie{
+			Name:     fields[5],
+			Value:    fields[6],
+			Path:     fields[2],
+			Secure:   fields[3] == "TRUE",
+			HttpOnly: httpOnly,
+		}
+		if fields[1] == "TRUE" {
+			// Also valid for subdomains
+			cookie.Domain = host
+		}
+		if expiry != 0 {
+			// 0 means it's a session cookie
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+
+		scheme := "http"
+		if cookie.Secure {
+			scheme = "https"
+		}
+		jar.SetCookies(&url.URL{Scheme: scheme, Host: host, Path: cookie.Path}, []*http.Cookie{cookie})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return jar, nil
+}
@@ -0,0 +1,347 @@
+// Package fixture lets the extractor tests run without network access: all
+// requests are answered with the recorded responses in testdata, and
+// youtube-dl is replaced by a script.
+package fixture
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Maps request URLs to the files in testdata they're answered with.
+var files = map[string]string{
+	"https://www.youtube.com": "youtube/home.html",
+	"https://www.youtube.com/s/player/f1xtur3a/player_ias.vflset/en_US/base.js": "youtube/base.js",
+
+	"https://www.youtube.com/@fixture": "youtube/channel.html",
+	"https://www.youtube.com/@missing": "youtube/channel_missing.html",
+
+	"https://suggestqueries-clients6.youtube.com/complete/search?client=youtube&ds=yt&q=black+velvet": "youtube/suggestions.js",
+	"https://suggestqueries-clients6.youtube.com/complete/search?client=youtube&ds=yt&q=malformed":    "youtube/suggestions_malformed.js",
+
+	// InnerTube API requests are POST requests; their URLs are followed by
+	// the client name and the parameters from the request body (see
+	// transport)
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureVid1": "youtube/player_video.json",
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureMus1": "youtube/player_unplayable.json",
+	"https://www.youtube.com/youtubei/v1/player IOS fixtureMus1":     "youtube/player_unplayable.json",
+	"https://www.youtube.com/youtubei/v1/player WEB fixtureMus1":     "youtube/player_cipher.json",
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureBrk1": "youtube/player_broken.json",
+	"https://www.youtube.com/youtubei/v1/player IOS fixtureBrk1":     "youtube/player_broken.json",
+	"https://www.youtube.com/youtubei/v1/player WEB fixtureBrk1":     "youtube/player_broken.json",
+	"https://www.youtube.com/youtubei/v1/player WEB fixtureBrk2":     "youtube/player_cipher_broken.json",
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureSil1": "youtube/player_noaudio.json",
+	"https://www.youtube.com/youtubei/v1/player IOS fixtureSil1":     "youtube/player_noaudio.json",
+	"https://www.youtube.com/youtubei/v1/player WEB fixtureSil1":     "youtube/player_noaudio.json",
+	// No other clients are asked for videos that are definitely unavailable
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureGone": "youtube/player_unavailable.json",
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixturePriv": "youtube/player_private.json",
+	"https://www.youtube.com/youtubei/v1/player ANDROID fixtureAge1": "youtube/player_age_restricted.json",
+
+	"https://www.youtube.com/youtubei/v1/browse WEB VLPLfixture":               "youtube/browse_playlist_1.json",
+	"https://www.youtube.com/youtubei/v1/browse WEB fixtureContinuation1":      "youtube/browse_playlist_2.json",
+	"https://www.youtube.com/youtubei/v1/browse WEB VLPLbroken":                "youtube/browse_playlist_malformed.json",
+	"https://www.youtube.com/youtubei/v1/browse WEB VLUUfixture":               "youtube/browse_channel_uploads.json",
+	"https://www.youtube.com/youtubei/v1/next WEB fixtureVid1 RDfixtureVid1 0": "youtube/next_mix_1.json",
+	"https://www.youtube.com/youtubei/v1/next WEB fixtureMx03 RDfixtureVid1 3": "youtube/next_mix_2.json",
+
+	"https://www.youtube.com/youtubei/v1/search WEB black velvet":                                  "youtube/search.json",
+	"https://www.youtube.com/youtubei/v1/search WEB hang":                                          "youtube/search.json",
+	"https://www.youtube.com/youtubei/v1/search WEB malformed":                                     "youtube/search_malformed.json",
+	"https://www.youtube.com/youtubei/v1/search WEB Fixture Podcast - Episode One":                 "youtube/search_episode.json",
+	"https://www.youtube.com/youtubei/v1/search WEB Infected Mushroom - While I'm in the Mood":     "youtube/search.json",
+	"https://www.youtube.com/youtubei/v1/search WEB Infected Mushroom, Ninet Tayeb - Black Velvet": "youtube/search.json",
+
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX black velvet":                                  "youtube/music_search.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX ILA161000123":                                  "youtube/music_search_spotify.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX ILA160700105":                                  "youtube/music_search_empty.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX Black Velvet - Infected Mushroom, Ninet Tayeb": "youtube/music_search_spotify.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX While I'm in the Mood - Infected Mushroom":     "youtube/music_search_empty.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX malformed":                                     "youtube/music_search_malformed.json",
+	"https://music.youtube.com/youtubei/v1/search WEB_REMIX Episode One - Fixture Podcast":                 "youtube/music_search_empty.json",
+	"https://music.youtube.com/youtubei/v1/browse WEB_REMIX MPREb_fixture":                                 "youtube/music_browse_album.json",
+	"https://music.youtube.com/youtubei/v1/browse WEB_REMIX MPREb_missing":                                 "youtube/music_browse_empty.json",
+
+	// SoundCloud API URLs are without the client_id parameter, which is
+	// checked by transport
+	"https://soundcloud.com":                       "soundcloud/home.html",
+	"https://a-v2.sndcdn.com/assets/49-fixture.js": "soundcloud/assets_49.js",
+	"https://a-v2.sndcdn.com/assets/50-fixture.js": "soundcloud/assets_50.js",
+
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band%2Fprelude":              "soundcloud/track.json",
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band%2Fslam":                 "soundcloud/track_mp3.json",
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band%2Fblocked":              "soundcloud/track_blocked.json",
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band%2Fpreview":              "soundcloud/track_preview.json",
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band%2Fsets%2Ffixture-album": "soundcloud/set.json",
+	"https://api-v2.soundcloud.com/resolve?url=https%3A%2F%2Fsoundcloud.com%2Ffixture-band":                        "soundcloud/user.json",
+
+	"https://api-v2.soundcloud.com/media/soundcloud:tracks:1001/opus_0_0/stream/hls?track_authorization=fixtureAuth1001":        "soundcloud/stream_opus.json",
+	"https://api-v2.soundcloud.com/media/soundcloud:tracks:1002/mp3_0_0/stream/progressive?track_authorization=fixtureAuth1002": "soundcloud/stream_mp3.json",
+
+	"https://api-v2.soundcloud.com/tracks?ids=1003%2C1004":                 "soundcloud/set_tracks.json",
+	"https://api-v2.soundcloud.com/users/42/tracks?limit=50":               "soundcloud/user_tracks_1.json",
+	"https://api-v2.soundcloud.com/users/42/tracks?limit=50&offset=2":      "soundcloud/user_tracks_2.json",
+	"https://api-v2.soundcloud.com/search?limit=10&q=black+velvet":         "soundcloud/search.json",
+	"https://api-v2.soundcloud.com/search?limit=10&q=malformed":            "soundcloud/search_empty.json",
+	"https://api-v2.soundcloud.com/search/queries?limit=10&q=black+velvet": "soundcloud/queries.json",
+	"https://api-v2.soundcloud.com/search/queries?limit=10&q=malformed":    "soundcloud/queries_empty.json",
+
+	"https://fixture.bandcamp.com/album/fixture-album":    "bandcamp/album.html",
+	"https://fixture.bandcamp.com/track/prelude":          "bandcamp/track.html",
+	"https://fixture.bandcamp.com/track/bonus-track":      "bandcamp/track_unavailable.html",
+	"https://fixture.bandcamp.com/track/not-a-track-page": "bandcamp/no_tralbum.html",
+
+	"https://open.spotify.com":                                                         "spotify/home.html",
+	"https://api.spotify.com/v1/tracks/fixtureTrk1":                                    "spotify/track.json",
+	"https://api.spotify.com/v1/tracks/fixtureTrk2":                                    "spotify/track_2.json",
+	"https://api.spotify.com/v1/tracks/fixtureMissing":                                 "spotify/not_found.json",
+	"https://api.spotify.com/v1/tracks/fixtureLimited":                                 "spotify/rate_limited.html",
+	"https://api.spotify.com/v1/albums/fixtureAlb1":                                    "spotify/album.json",
+	"https://api.spotify.com/v1/albums/fixtureAlb1/tracks?offset=2&limit=2":            "spotify/album_tracks_2.json",
+	"https://api.spotify.com/v1/playlists/fixturePls1":                                 "spotify/playlist.json",
+	"https://api.spotify.com/v1/playlists/fixturePls1/tracks?offset=1&limit=1":         "spotify/playlist_tracks_2.json",
+	"https://api.spotify.com/v1/artists/fixtureArt1":                                   "spotify/artist.json",
+	"https://api.spotify.com/v1/artists/fixtureArt1/top-tracks?market=US":              "spotify/artist_top_tracks.json",
+	"https://api.spotify.com/v1/shows/fixtureShw1?market=US":                           "spotify/show.json",
+	"https://api.spotify.com/v1/shows/fixtureShw1/episodes?offset=1&limit=1&market=US": "spotify/show_episodes_2.json",
+	"https://api.spotify.com/v1/episodes/fixtureEp1?market=US":                         "spotify/episode.json",
+	"https://api.spotify.com/v1/episodes/fixtureMissing?market=US":                     "spotify/not_found.json",
+
+	"https://api.deezer.com/track/fixtureTrk1":                        "deezer/track.json",
+	"https://api.deezer.com/track/fixtureMissing":                     "deezer/not_found.json",
+	"https://api.deezer.com/album/fixtureAlb1":                        "deezer/album.json",
+	"https://api.deezer.com/album/fixtureAlb1/tracks":                 "deezer/album_tracks.json",
+	"https://api.deezer.com/album/fixtureAlb1/tracks?index=1&limit=1": "deezer/album_tracks_2.json",
+	"https://api.deezer.com/playlist/fixturePls1":                     "deezer/playlist.json",
+	"https://api.deezer.com/playlist/fixturePls1/tracks":              "deezer/playlist_tracks.json",
+
+	"https://music.apple.com/us/song/fixtureSng1":     "applemusic/song.html",
+	"https://music.apple.com/us/song/fixtureMissing":  "applemusic/not_found.html",
+	"https://music.apple.com/us/album/fixtureAlb1":    "applemusic/album.html",
+	"https://music.apple.com/us/playlist/pl.fixture1": "applemusic/playlist.html",
+}
+
+// Share links and the like, answered with a redirect to the given URL
+var redirects = map[string]string{
+	"https://link.deezer.com/s/fixtureShr1": "https://www.deezer.com/de/track/fixtureTrk1?host=0&utm_campaign=fixture",
+	"https://deezer.page.link/fixtureShr2":  "https://link.deezer.com/s/fixtureShr3",
+	"https://link.deezer.com/s/fixtureShr3": "https://www.deezer.com/album/fixtureAlb1?utm_source=fixture",
+	"https://link.deezer.com/s/fixtureShr4": "https://www.deezer.com/en/",
+}
+
+// Returns the testdata directory, wherever the tests are run from.
+func dir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata")
+}
+
+type transport struct {
+	t *testing.T
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	respond := func(status int, body string) (*http.Response, error) {
+		return &http.Response{
+			Status:     http.StatusText(status),
+			StatusCode: status,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	}
+
+	if strings.HasSuffix(req.URL.Host, ".googlevideo.com") {
+		// Stream URLs only get checked for whether they work
+		if strings.Contains(req.URL.RawQuery, "id=o-broken") {
+			return respond(http.StatusForbidden, "")
+		}
+		return respond(http.StatusOK, "")
+	}
+
+	if location, ok := redirects[req.URL.String()]; ok {
+		resp, err := respond(http.StatusFound, "")
+		resp.Header.Set("Location", location)
+		return resp, err
+	}
+
+	if req.URL.Host == "api.spotify.com" && req.Header.Get("Authorization") != "Bearer fixture-token" {
+		return respond(http.StatusUnauthorized, `{"error":{"status":401,"message":"No token provided"}}`)
+	}
+
+	u := *req.URL
+	if u.Host == "api-v2.soundcloud.com" {
+		q := u.Query()
+		if q.Get("client_id") != "fixtureClientId00000000000000000" {
+			return respond(http.StatusUnauthorized, "")
+		}
+		if q.Get("q") == "hang" {
+			// Never responds
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		q.Del("client_id")
+		u.RawQuery = q.Encode()
+	}
+
+	key := u.String()
+	if strings.HasPrefix(u.Path, "/youtubei/") {
+		var body struct {
+			Context struct {
+				Client struct {
+					ClientName string `json:"clientName"`
+				} `json:"client"`
+			} `json:"context"`
+			VideoId         string `json:"videoId"`
+			PlaylistId      string `json:"playlistId"`
+			PlaylistIndex   *int   `json:"playlistIndex"`
+			Query           string `json:"query"`
+			BrowseId        string `json:"browseId"`
+			Continuation    string `json:"continuation"`
+			PlaybackContext struct {
+				ContentPlaybackContext struct {
+					SignatureTimestamp int `json:"signatureTimestamp"`
+				} `json:"contentPlaybackContext"`
+			} `json:"playbackContext"`
+		}
+		if req.Method != "POST" || json.NewDecoder(req.Body).Decode(&body) != nil || body.Context.Client.ClientName == "" {
+			return respond(http.StatusBadRequest, "")
+		}
+		if body.Context.Client.ClientName == "WEB" && strings.HasSuffix(u.Path, "/player") &&
+			body.PlaybackContext.ContentPlaybackContext.SignatureTimestamp != 19700 {
+			// Without it, the signatures couldn't be decrypted
+			return respond(http.StatusBadRequest, "")
+		}
+		if u.Host == "music.youtube.com" && body.Query == "hang" {
+			// Never responds
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		parts := []string{key, body.Context.Client.ClientName}
+		for _, p := range []string{body.VideoId, body.PlaylistId} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		if body.PlaylistIndex != nil {
+			parts = append(parts, strconv.Itoa(*body.PlaylistIndex))
+		}
+		for _, p := range []string{body.Query, body.BrowseId, body.Continuation} {
+			if p != "" {
+				parts = append(parts, p)
+			}
+		}
+		key = strings.Join(parts, " ")
+	}
+
+	name, ok := files[key]
+	if !ok {
+		tr.t.Errorf("Unexpected request: %v", key)
+		return respond(http.StatusNotFound, "")
+	}
+	data, err := os.ReadFile(filepath.Join(dir(), name))
+	if err != nil {
+		return nil, err
+	}
+	return respond(http.StatusOK, string(data))
+}
+
+// Returns the default configuration, except that all requests are answered
+// from testdata and youtube-dl is replaced by the fake one.
+func Config(t *testing.T) extractor.Config {
+	cfg := extractor.DefaultConfig()
+	cfg.SetHttpClient(&http.Client{Transport: &transport{t}})
+	cfg.SetCache(extractor.NewFileCache(t.TempDir()))
+	ytdlPath, err := filepath.Abs(filepath.Join(dir(), "ytdl", "fake-youtube-dl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg["youtube-dl"]["youtube-dl-path"] = ytdlPath
+	return cfg
+}
+
+// Skips tests which use the fake youtube-dl where it can't run.
+func SkipWithoutShell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake youtube-dl is a shell script")
+	}
+}
+
+// Checks and clears the expiry date, so the rest can be compared directly.
+func CheckExpires(t *testing.T, d *extractor.Data, in time.Duration) {
+	if d.Expires.Before(time.Now().Add(in-time.Minute)) || d.Expires.After(time.Now().Add(in)) {
+		t.Errorf("Invalid expiry date for '%v': %v", d.SourceUrl, d.Expires)
+	}
+	d.Expires = time.Time{}
+}
+
+// Compares results field by field, in order.
+func CheckData(t *testing.T, got, expected []extractor.Data) {
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v results but got %v: %+v", len(expected), len(got), got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("Invalid result %v:\nexpected %+v\n     got %+v", i, expected[i], got[i])
+		}
+	}
+}
+
+// Returns the thumbnail URL the YouTube extractor uses for a video.
+func YoutubeThumbnail(id string) string {
+	return "https://i.ytimg.com/vi/" + id + "/mqdefault.jpg"
+}
+
+// A playlist (or an album, a channel's uploads etc.) whose entries a test
+// expects.
+type Playlist struct {
+	Url   string
+	Title string
+}
+
+// An entry of the playlist, the way it's extracted before it's played (i.e.
+// without a stream).
+func (p Playlist) Entry(sourceUrl, title, uploader string, duration int) extractor.Data {
+	return extractor.Data{
+		SourceUrl:     sourceUrl,
+		Title:         title,
+		PlaylistUrl:   p.Url,
+		PlaylistTitle: p.Title,
+		Uploader:      uploader,
+		Duration:      duration,
+	}
+}
+
+// Like Entry(), but for tracks on music sites, whose uploader is the artist.
+func (p Playlist) Track(sourceUrl, title, artist string, duration int) extractor.Data {
+	d := p.Entry(sourceUrl, title, artist, duration)
+	d.Artist = artist
+	return d
+}
+
+// Like Entry(), but for YouTube videos, which have a thumbnail as well.
+func (p Playlist) YoutubeVideo(id, title, uploader string, duration int) extractor.Data {
+	d := p.Entry("https://www.youtube.com/watch?v="+id, title, uploader, duration)
+	d.Thumbnail = YoutubeThumbnail(id)
+	return d
+}
+
+// Returns the track with the album it's from.
+func FromAlbum(d extractor.Data, album string, year int, cover string) extractor.Data {
+	d.Album = album
+	d.Year = year
+	d.Thumbnail = cover
+	return d
+}
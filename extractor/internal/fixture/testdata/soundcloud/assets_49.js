@@ -0,0 +1 @@
+(self.webpackChunk=self.webpackChunk||[]).push([[49],{1:function(e,t,n){"use strict";var r=n(2);t.config={env:"production",client_id:"fixtureClientId00000000000000000",api_host:"api-v2.soundcloud.com"}}}]);
@@ -0,0 +1 @@
+(self.webpackChunk=self.webpackChunk||[]).push([[50],{3:function(e,t,n){"use strict";t.render=function(){return null}}}]);
@@ -0,0 +1,13 @@
+var _yt_player={};(function(g){var window=this;
+var Tx={cd:function(a){a.reverse()},
+ef:function(a,b){var c=a[0];a[0]=a[b%a.length];a[b%a.length]=c},
+gh:function(a,b){a.splice(0,b)}};
+Xq=function(a){a=a.split("");Tx.cd(a,2);Tx.ef(a,3);Tx.gh(a,1);return a.join("")};
+var Qz=function(a){var b=a.split(""),c=["}",/[{}"]/g,function(d){return d.replace(c[1],"")}];if(typeof Lk==="undefined")return a;
+try{for(var d=0;d<b.length;d++)b[d]=String.fromCharCode(b[d].charCodeAt(0)+1);b.reverse()}catch(e){return"enhanced_except_"+a}
+return c[2](b.join("")+c[0])};
+var Nz=[Qz];
+g.Mv={signatureTimestamp:19700,enablePlayerThrottling:!0};
+g.Jo=function(a,b,c){c&&(c=Xq(decodeURIComponent(c)),b.set(a,encodeURIComponent(c)))};
+g.Kp=function(a){var b;(b=a.get("n"))&&(b=Nz[0](b),a.set("n",b))};
+})(_yt_player);
@@ -0,0 +1 @@
+window.google.ac.h(["black velvet",[["black velvet",0,[512]],["black velvet infected mushroom",0,[512,433]],["black velvet lyrics",0,[512]]],{"k":1,"q":"fixture"}])
\ No newline at end of file
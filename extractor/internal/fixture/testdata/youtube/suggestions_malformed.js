@@ -0,0 +1 @@
+window.google.ac.h(["black velvet",{"k":1}])
\ No newline at end of file
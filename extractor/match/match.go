@@ -0,0 +1,407 @@
+package match
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/extractor/youtube"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// Once a video is this likely to be the track, no more searches are made
+	goodMatchConfidence = 0.8
+	// Videos whose duration differs from the track's by more than this many
+	// seconds are most likely a different version
+	durationWindow = 10
+	// How long a track is played from the same video before searching for it
+	// again; matches fixed by hand are kept forever
+	matchCacheDuration = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTrackNotFound            = errors.New("unable to find track on YouTube")
+	ErrUnableToGetYoutubeStream = errors.New("unable to get YouTube stream")
+	ErrInvalidMatchUrl          = errors.New("not a YouTube video URL")
+)
+
+// The metadata of a track (or anything else that's played from YouTube, like
+// podcast episodes) on a site which doesn't have streams of its own.
+type Track struct {
+	SourceUrl string
+	Name      string   // without the artists
+	Artists   []string // main artist first
+	Album     string   // "" if unknown
+	Year      int      // 0 if unknown
+	Thumbnail string   // e.g. the album cover; "" if unknown
+	Duration  int      // in seconds; -1 if unknown
+	Isrc      string   // "" if unknown
+}
+
+func (t Track) ArtistsString() string {
+	return strings.Join(t.Artists, ", ")
+}
+
+// The track's title, the way it's shown to users (e.g. "Artist - Name").
+func (t Track) TitleString() string {
+	if len(t.Artists) == 0 {
+		return t.Name
+	}
+	return t.ArtistsString() + " - " + t.Name
+}
+
+// Finds the YouTube videos to play tracks from. Matches are cached (see
+// extractor.ProviderCache()) by an ID the provider chooses, so that the same
+// track is always played from the same video and can be fixed by hand.
+type Matcher struct {
+	name              string
+	ytSearcher        *youtube.Searcher
+	ytSearcherConfig  extractor.ProviderConfig
+	ytmSearcher       *youtube.MusicSearcher
+	ytmSearcherConfig extractor.ProviderConfig
+	ytExtractor       *youtube.Extractor
+	ytExtractorConfig extractor.ProviderConfig
+}
+
+// Cache keys start with name, which should be the provider's name.
+func NewMatcher(name string) *Matcher {
+	m := &Matcher{name: name}
+	m.ytSearcher = &youtube.Searcher{}
+	m.ytSearcherConfig = m.ytSearcher.DefaultConfig()
+	m.ytmSearcher = &youtube.MusicSearcher{}
+	m.ytmSearcherConfig = m.ytmSearcher.DefaultConfig()
+	m.ytExtractor = &youtube.Extractor{}
+	m.ytExtractorConfig = m.ytExtractor.DefaultConfig()
+	return m
+}
+
+// The YouTube video a track is played from.
+type cachedMatch struct {
+	Url        string  `json:"url"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (m *Matcher) cacheKey(id string) string {
+	return m.name + "-match-" + id
+}
+
+// Plays the track with the given ID from the YouTube video it was matched
+// with before or, if there's none, from the one which is most likely to be
+// it. The result has the track's metadata.
+func (m *Matcher) Get(ctx context.Context, cfg extractor.ProviderConfig, id string, t Track) (extractor.Data, error) {
+	cache := extractor.ProviderCache(cfg)
+	key := m.cacheKey(id)
+	var match cachedMatch
+	if cached, ok := cache.Get(key); ok && json.Unmarshal(cached, &match) == nil && match.Url != "" {
+		res, err := m.getStream(ctx, cfg, t, match)
+		if err == nil {
+			return res, nil
+		}
+		if ctx.Err() != nil {
+			return extractor.Data{}, ctx.Err()
+		}
+		// The video may have been taken down; look for another one
+	}
+
+	candidates, err := m.candidates(ctx, cfg, t, false)
+	if err != nil {
+		return extractor.Data{}, err
+	}
+	match = cachedMatch{
+		Url:        candidates[0].SourceUrl,
+		Confidence: candidates[0].MatchConfidence,
+	}
+	res, err := m.getStream(ctx, cfg, t, match)
+	if err != nil {
+		return extractor.Data{}, err
+	}
+	if cached, err := json.Marshal(match); err == nil {
+		cache.Set(key, cached, time.Now().Add(matchCacheDuration))
+	}
+	return res, nil
+}
+
+// Returns the stream of the matched video, with the track's metadata (as the
+// video's would be about the video, not the track).
+func (m *Matcher) getStream(ctx context.Context, cfg extractor.ProviderConfig, t Track, match cachedMatch) (extractor.Data, error) {
+	ytData, err := m.ytExtractor.Extract(ctx, extractor.WithHttp(m.ytExtractorConfig, cfg), match.Url)
+	if err != nil {
+		return extractor.Data{}, err
+	}
+
+	if len(ytData) != 1 {
+		return extractor.Data{}, ErrUnableToGetYoutubeStream
+	}
+
+	return extractor.Data{
+		SourceUrl:       t.SourceUrl,
+		StreamUrl:       ytData[0].StreamUrl,
+		Title:           t.TitleString(),
+		Uploader:        t.ArtistsString(),
+		Artist:          t.ArtistsString(),
+		Album:           t.Album,
+		Year:            t.Year,
+		Thumbnail:       t.Thumbnail,
+		Duration:        ytData[0].Duration,
+		Expires:         ytData[0].Expires,
+		MatchConfidence: match.Confidence,
+	}, nil
+}
+
+// Searches YouTube for the track and returns all results that might be it,
+// most likely first, with their MatchConfidence set (see
+// extractor.MatchingExtractor).
+func (m *Matcher) Candidates(ctx context.Context, cfg extractor.ProviderConfig, t Track) ([]extractor.Data, error) {
+	return m.candidates(ctx, cfg, t, true)
+}
+
+// Unless all is true, no more searches are made once a result is likely
+// enough to be the track.
+func (m *Matcher) candidates(ctx context.Context, cfg extractor.ProviderConfig, t Track, all bool) ([]extractor.Data, error) {
+	ytm := func(ctx context.Context, query string) ([]extractor.Data, error) {
+		return m.ytmSearcher.Search(ctx, extractor.WithHttp(m.ytmSearcherConfig, cfg), query)
+	}
+	yt := func(ctx context.Context, query string) ([]extractor.Data, error) {
+		return m.ytSearcher.Search(ctx, extractor.WithHttp(m.ytSearcherConfig, cfg), query)
+	}
+
+	// The ISRC identifies the exact recording, and YouTube Music (which only
+	// has songs) often finds it by that; otherwise fall back to searching for
+	// the names, on regular YouTube last
+	type search struct {
+		search func(context.Context, string) ([]extractor.Data, error)
+		query  string
+	}
+	var searches []search
+	if t.Isrc != "" {
+		searches = append(searches, search{ytm, t.Isrc})
+	}
+	searches = append(searches,
+		search{ytm, t.Name + " - " + t.ArtistsString()},
+		search{yt, t.TitleString()},
+	)
+
+	results := make([][]extractor.Data, len(searches))
+	errs := make([]error, len(searches))
+	run := func(i int) {
+		results[i], errs[i] = searches[i].search(ctx, searches[i].query)
+	}
+	if all {
+		// None of them are skipped, so there's no need to wait for one
+		// before making the next
+		var wg sync.WaitGroup
+		for i := range searches {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	var res []extractor.Data
+	seen := make(map[string]bool)
+	var firstErr error
+	for i := range searches {
+		if !all {
+			run(i)
+		}
+		if err := errs[i]; err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for _, v := range results[i] {
+			if seen[v.SourceUrl] {
+				continue
+			}
+			seen[v.SourceUrl] = true
+			if v.MatchConfidence = confidence(t, v); v.MatchConfidence > 0 {
+				res = append(res, v)
+			}
+		}
+		// On a tie, the earlier result wins
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].MatchConfidence > res[j].MatchConfidence
+		})
+		if !all && len(res) > 0 && res[0].MatchConfidence >= goodMatchConfidence {
+			break
+		}
+	}
+	if len(res) == 0 {
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		return nil, ErrTrackNotFound
+	}
+	return res, nil
+}
+
+// Makes the track with the given ID play the YouTube video vUrl from now on.
+// vUrl must lead to exactly one video, not e.g. to a playlist.
+func (m *Matcher) Fix(ctx context.Context, cfg extractor.ProviderConfig, id, vUrl string) error {
+	if !m.ytExtractor.Matches(m.ytExtractorConfig, vUrl) {
+		return ErrInvalidMatchUrl
+	}
+	// Stop as soon as there's more than one video, there's no need to get
+	// all of a playlist
+	var ytData []extractor.Data
+	err := m.ytExtractor.ExtractFunc(ctx, extractor.WithHttp(m.ytExtractorConfig, cfg), vUrl, func(data []extractor.Data) error {
+		ytData = append(ytData, data...)
+		if len(ytData) > 1 {
+			return ErrInvalidMatchUrl
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(ytData) != 1 {
+		return ErrInvalidMatchUrl
+	}
+	// Whoever picked it knows best
+	cached, err := json.Marshal(cachedMatch{Url: ytData[0].SourceUrl, Confidence: 1})
+	if err != nil {
+		return err
+	}
+	return extractor.ProviderCache(cfg).Set(m.cacheKey(id), cached, time.Time{})
+}
+
+// Words in video titles that don't tell anything about the song
+var fillerWords = map[string]bool{
+	"official": true, "video": true, "audio": true, "music": true,
+	"lyrics": true, "lyric": true, "hd": true, "hq": true, "4k": true,
+	"feat": true, "ft": true, "featuring": true, "remastered": true,
+	"visualizer": true, "clip": true, "mv": true, "topic": true,
+}
+
+// Words in video titles that hint at a different version of the song, unless
+// the track itself has them
+var versionWords = []string{
+	"instrumental", "cover", "live", "remix", "rmx", "mix", "vip", "karaoke",
+	"acoustic", "nightcore", "sped", "slowed", "8d", "reverb",
+}
+
+// Splits s into lowercase words, ignoring punctuation.
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func tokenSet(ss ...string) map[string]bool {
+	res := make(map[string]bool)
+	for _, s := range ss {
+		for _, t := range tokens(s) {
+			res[t] = true
+		}
+	}
+	return res
+}
+
+// Returns how likely it is that the YouTube video ytd is the track, from 0 to
+// 1. The gist of it:
+//   - the title score is the portion of the track name's words in the video
+//     title, minus a bit for every word that's explained by neither the
+//     track's name, its artists nor its album
+//   - the artist score is the portion of the artists named in the video's
+//     title or uploader, with the first (main) artist counting for half
+//   - the duration score is 1 if the durations are about the same and falls
+//     off until durationWindow; outside of it, everything is halved
+//   - the weighted sum of these is halved for every word hinting at a
+//     different version (remix, live etc.)
+//   - official artist channels (or auto-generated "Topic" ones) get a bonus
+//     if one of the artists matches
+func confidence(t Track, ytd extractor.Data) float64 {
+	trackTokens := tokenSet(t.Name, t.ArtistsString(), t.Album)
+	ytTokens := tokenSet(ytd.Title, ytd.Uploader)
+
+	// Title
+	nameTokens := tokens(t.Name)
+	titleScore := 0.0
+	if len(nameTokens) > 0 {
+		found := 0
+		for _, tok := range nameTokens {
+			if ytTokens[tok] {
+				found++
+			}
+		}
+		titleScore = float64(found) / float64(len(nameTokens))
+	}
+	for _, tok := range tokens(ytd.Title) {
+		if !trackTokens[tok] && !fillerWords[tok] {
+			titleScore -= 0.05
+		}
+	}
+	if titleScore < 0 {
+		titleScore = 0
+	}
+
+	// Artists
+	artistScore := 0.0
+	if len(t.Artists) > 0 {
+		found := 0
+		for i, artist := range t.Artists {
+			all := true
+			for _, tok := range tokens(artist) {
+				if !ytTokens[tok] {
+					all = false
+					break
+				}
+			}
+			if all {
+				found++
+				if i == 0 {
+					artistScore += 0.5
+				}
+			}
+		}
+		artistScore += 0.5 * float64(found) / float64(len(t.Artists))
+	}
+
+	// Duration
+	durationScore := 0.5
+	outsideWindow := false
+	if ytd.Duration >= 0 && t.Duration > 0 {
+		dist := ytd.Duration - t.Duration
+		if dist < 0 {
+			dist = -dist
+		}
+		if dist <= 2 {
+			durationScore = 1
+		} else if dist <= durationWindow {
+			durationScore = 1 - float64(dist-2)/float64(durationWindow-2)
+		} else {
+			durationScore = 0
+			outsideWindow = true
+		}
+	}
+
+	res := (4*titleScore + 3*artistScore + 3*durationScore) / 10
+	if outsideWindow {
+		res /= 2
+	}
+	for _, w := range versionWords {
+		if ytTokens[w] && !trackTokens[w] {
+			res /= 2
+		}
+	}
+	if (ytd.OfficialArtist || strings.HasSuffix(ytd.Uploader, " - Topic")) && artistScore > 0 {
+		res += (1 - res) / 5
+	}
+	if res > 1 {
+		res = 1
+	}
+	return res
+}
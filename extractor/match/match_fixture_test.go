@@ -0,0 +1,89 @@
+package match_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/match"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureSpotifyFixMatch(t *testing.T) {
+	cfg := fixture.Config(t)
+	input := "https://open.spotify.com/track/fixtureTrk1"
+
+	// All searches are made, and the results are sorted by how likely they
+	// are to be the track
+	data, err := extractor.MatchCandidates(context.Background(), cfg, input)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expected := []string{
+		"https://www.youtube.com/watch?v=fixtureMus1",
+		"https://www.youtube.com/watch?v=fixtureCov1",
+		"https://www.youtube.com/watch?v=fixtureLiv1",
+		"https://www.youtube.com/watch?v=fixtureAlm1",
+	}
+	if len(data) != len(expected) {
+		t.Fatalf("Expected %v candidates but got %+v", len(expected), data)
+	}
+	for i := range data {
+		if data[i].SourceUrl != expected[i] {
+			t.Errorf("Expected candidate %v to be %v but got %v", i, expected[i], data[i].SourceUrl)
+		}
+		if data[i].MatchConfidence <= 0 || data[i].MatchConfidence > 1 {
+			t.Errorf("Invalid match confidence of candidate %v: %v", i, data[i].MatchConfidence)
+		}
+	}
+
+	// Once fixed, the track is played from the chosen video
+	if err := extractor.FixMatch(context.Background(), cfg, input, "https://www.youtube.com/watch?v=fixtureVid1"); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	data, err = extractor.Extract(context.Background(), cfg, input)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) == 1 {
+		fixture.CheckExpires(t, &data[0], 21540*time.Second)
+	}
+	fixture.CheckData(t, data, []extractor.Data{{
+		SourceUrl:       "https://open.spotify.com/track/fixtureTrk1",
+		StreamUrl:       "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-video&itag=251",
+		Title:           "Infected Mushroom, Ninet Tayeb - Black Velvet",
+		Uploader:        "Infected Mushroom, Ninet Tayeb",
+		Artist:          "Infected Mushroom, Ninet Tayeb",
+		Album:           "Head of NASA and the 2 Amish Boys",
+		Year:            2010,
+		Thumbnail:       "https://i.scdn.co/image/fixtureAlb1-640",
+		Duration:        212,
+		MatchConfidence: 1,
+	}})
+
+	// Only single videos that can be played
+	for _, c := range []struct {
+		url string
+		err error
+	}{
+		{"https://example.com/video", match.ErrInvalidMatchUrl},
+		{"https://www.youtube.com/playlist?list=PLfixture", match.ErrInvalidMatchUrl},
+		{"https://www.youtube.com/watch?v=fixtureGone", extractor.ErrUnavailable},
+	} {
+		if err := extractor.FixMatch(context.Background(), cfg, input, c.url); !errors.Is(err, c.err) {
+			t.Errorf("%v: Expected %v but got %v", c.url, c.err, err)
+		}
+	}
+	for _, input := range []string{
+		"https://open.spotify.com/album/fixtureAlb1",
+		"https://www.youtube.com/watch?v=fixtureVid1",
+	} {
+		if _, err := extractor.MatchCandidates(context.Background(), cfg, input); !errors.Is(err, extractor.ErrNotMatched) {
+			t.Errorf("%v: Expected %v but got %v", input, extractor.ErrNotMatched, err)
+		}
+	}
+}
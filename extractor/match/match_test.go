@@ -0,0 +1,86 @@
+package match
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+
+	"math"
+
+	"testing"
+)
+
+func TestConfidence(t *testing.T) {
+	track := Track{
+		Name:     "Black Velvet",
+		Artists:  []string{"Infected Mushroom"},
+		Duration: 260,
+	}
+	featTrack := track
+	featTrack.Artists = []string{"Infected Mushroom", "Ninet Tayeb"}
+
+	for _, test := range []struct {
+		name     string
+		track    Track
+		video    extractor.Data
+		expected float64
+	}{
+		{
+			"exact match",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet (Official Video)", Uploader: "Infected Mushroom", Duration: 261},
+			1,
+		},
+		{
+			"only the main artist",
+			featTrack,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet", Uploader: "Some Channel", Duration: 260},
+			(4*1 + 3*0.75 + 3*1) / 10.0,
+		},
+		{
+			"unrelated words in the title",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet but it's a bit different", Uploader: "Infected Mushroom", Duration: 260},
+			(4*(1-6*0.05) + 3*1 + 3*1) / 10.0,
+		},
+		{
+			"duration within the window",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet", Uploader: "Infected Mushroom", Duration: 266},
+			(4*1 + 3*1 + 3*0.5) / 10.0,
+		},
+		{
+			"duration outside of the window",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet", Uploader: "Infected Mushroom", Duration: 290},
+			(4*1 + 3*1 + 3*0) / 10.0 / 2,
+		},
+		{
+			"unknown duration",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet", Uploader: "Infected Mushroom", Duration: -1},
+			(4*1 + 3*1 + 3*0.5) / 10.0,
+		},
+		{
+			"different version",
+			track,
+			extractor.Data{Title: "Infected Mushroom - Black Velvet (Live)", Uploader: "Infected Mushroom", Duration: 260},
+			(4*(1-0.05) + 3*1 + 3*1) / 10.0 / 2,
+		},
+		{
+			"topic channel bonus",
+			track,
+			extractor.Data{Title: "Black Velvet", Uploader: "Infected Mushroom - Topic", Duration: 266},
+			0.85 + (1-0.85)/5,
+		},
+		{
+			"no bonus without a matching artist",
+			track,
+			extractor.Data{Title: "Black Velvet", Uploader: "Alannah Myles", Duration: 266, OfficialArtist: true},
+			(4*1 + 3*0 + 3*0.5) / 10.0,
+		},
+	} {
+		res := confidence(test.track, test.video)
+		if math.Abs(res-test.expected) > 1e-9 {
+			t.Errorf("%v: expected %v but got %v", test.name, test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package soundcloud
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	extractor.AddExtractor("soundcloud", &Extractor{})
+	extractor.AddSearcher("soundcloud-search", &Searcher{})
+	extractor.AddSuggestor("soundcloud-search-suggestions", &Suggestor{})
+}
+
+var (
+	ErrInvalidInput = errors.New("invalid input")
+)
+
+// Paths on soundcloud.com that aren't users.
+var reservedPaths = map[string]struct{}{
+	"discover": {},
+	"search":   {},
+	"stream":   {},
+	"upload":   {},
+	"you":      {},
+	"charts":   {},
+	"stations": {},
+	"pages":    {},
+	"settings": {},
+}
+
+func matches(input string) bool {
+	u, err := url.Parse(input)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	switch u.Host {
+	case "soundcloud.com", "www.soundcloud.com", "m.soundcloud.com":
+	default:
+		return false
+	}
+	// <user>, <user>/<track> or <user>/sets/<set>
+	sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if sp[0] == "" || len(sp) > 3 {
+		return false
+	}
+	if _, ok := reservedPaths[sp[0]]; ok {
+		return false
+	}
+	return len(sp) != 3 || sp[1] == "sets"
+}
+
+type Extractor struct{}
+
+func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{
+		// Only the most recent uploads of a user are added
+		"max-user-tracks": int64(50),
+	}
+}
+
+func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
+	return matches(input)
+}
+
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	if !matches(input) {
+		return nil, ErrInvalidInput
+	}
+	client := extractor.HttpClient(cfg)
+	kind, raw, err := resolve(ctx, client, input)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "track":
+		var t trackData
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, ErrDecodingApiResponse
+		}
+		d, err := getTrack(ctx, client, t)
+		if err != nil {
+			return nil, err
+		}
+		return []extractor.Data{d}, nil
+	case "playlist":
+		var p playlistData
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, ErrDecodingApiResponse
+		}
+		return getPlaylist(ctx, client, p)
+	case "user":
+		var u userData
+		if err := json.Unmarshal(raw, &u); err != nil {
+			return nil, ErrDecodingApiResponse
+		}
+		return getUserTracks(ctx, client, u, int(cfg["max-user-tracks"].(int64)))
+	}
+	return nil, ErrUnsupportedKind
+}
+
+type Searcher struct{}
+
+func (s *Searcher) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{
+		"search-prefix": "sc",
+		"max-results":   int64(10),
+		// Show YouTube's results first
+		"priority": int64(-5),
+	}
+}
+
+func (s *Searcher) Search(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	return getSearch(ctx, extractor.HttpClient(cfg), input, int(cfg["max-results"].(int64)))
+}
+
+type Suggestor struct{}
+
+func (s *Suggestor) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{
+		// Only used if YouTube's suggestions fail
+		"priority": int64(-5),
+	}
+}
+
+func (s *Suggestor) Suggest(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]string, error) {
+	return getSearchSuggestions(ctx, extractor.HttpClient(cfg), input)
+}
@@ -0,0 +1,433 @@
+package soundcloud
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	exutil "git.nobrain.org/r4/dischord/extractor/util"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrGettingClientId          = errors.New("unable to find the client ID in the web app's scripts")
+	ErrClientIdRejected         = errors.New("client ID was rejected by the API")
+	ErrApiRequestFailed         = errors.New("API request failed")
+	ErrDecodingApiResponse      = errors.New("error decoding API response")
+	ErrUnsupportedKind          = errors.New("unsupported kind of resource (only tracks, sets and users are supported)")
+	ErrTrackUnavailable         = fmt.Errorf("%w: track may be blocked in this country", extractor.ErrUnavailable)
+	ErrNoSuitableTranscoding    = errors.New("no suitable audio format found (perhaps only a preview is available)")
+	ErrGettingTrackStreamingUrl = errors.New("unable to get the track's streaming URL")
+)
+
+const (
+	baseUrl = "https://soundcloud.com"
+	apiUrl  = "https://api-v2.soundcloud.com"
+	// The API returns at most this many tracks per request
+	maxTracksPerRequest = 50
+	// Streaming URLs are signed and only valid for a short while
+	streamUrlLifetime = 5 * time.Minute
+)
+
+// The web app uses a client ID to authenticate with the API, which changes
+// every now and then. We get it the same way the web app does, which is from
+// one of its script bundles.
+type clientIdCache struct {
+	mu sync.Mutex
+	id string
+}
+
+// Shared by all SoundCloud providers.
+var clientIds clientIdCache
+
+var clientIdRegexp = regexp.MustCompile(`client_id\s*[:=]\s*"([0-9a-zA-Z]{32})"`)
+var scriptSrcRegexp = regexp.MustCompile(`<script[^>]+src="(https://[^"]+\.js)"`)
+
+func (c *clientIdCache) get(ctx context.Context, client *http.Client) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id != "" {
+		// Client ID already known
+		return c.id, nil
+	}
+
+	body, err := getString(ctx, client, baseUrl)
+	if err != nil {
+		return "", err
+	}
+	scripts := scriptSrcRegexp.FindAllStringSubmatch(body, -1)
+	// The client ID is usually in one of the last scripts
+	for i := len(scripts) - 1; i >= 0; i-- {
+		js, err := getString(ctx, client, scripts[i][1])
+		if err != nil {
+			return "", err
+		}
+		if m := clientIdRegexp.FindStringSubmatch(js); m != nil {
+			c.id = m[1]
+			return c.id, nil
+		}
+	}
+	return "", ErrGettingClientId
+}
+
+// Makes sure the given client ID isn't used again.
+func (c *clientIdCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.id == id {
+		c.id = ""
+	}
+}
+
+func getString(ctx context.Context, client *http.Client, url string) (string, error) {
+	resp, err := exutil.HttpGet(ctx, client, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %v: %v", ErrApiRequestFailed, url, resp.Status)
+	}
+	buf := new(strings.Builder)
+	if _, err := io.Copy(buf, resp.Body); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Decodes the JSON at the given API URL into v. The URL may already have
+// query parameters (e.g. if it's the next page of a collection), query is
+// added to them.
+func apiGet(ctx context.Context, client *http.Client, rawUrl string, query url.Values, v any) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	for k, vs := range query {
+		q[k] = vs
+	}
+
+	// A rejected client ID might just be outdated, so we try again with a
+	// new one
+	for try := 0; try < 2; try++ {
+		id, err := clientIds.get(ctx, client)
+		if err != nil {
+			return err
+		}
+		q.Set("client_id", id)
+		u.RawQuery = q.Encode()
+
+		resp, err := exutil.HttpGet(ctx, client, u.String())
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			resp.Body.Close()
+			clientIds.invalidate(id)
+			continue
+		}
+		err = decodeApiResponse(resp, v)
+		resp.Body.Close()
+		return err
+	}
+	return ErrClientIdRejected
+}
+
+func decodeApiResponse(resp *http.Response, v any) error {
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %v", ErrApiRequestFailed, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return ErrDecodingApiResponse
+	}
+	return nil
+}
+
+type userData struct {
+	Kind         string `json:"kind"`
+	Id           int64  `json:"id"`
+	Username     string `json:"username"`
+	PermalinkUrl string `json:"permalink_url"`
+}
+
+type transcoding struct {
+	Url     string `json:"url"`
+	Preset  string `json:"preset"`
+	Snipped bool   `json:"snipped"` // only a preview
+	Format  struct {
+		Protocol string `json:"protocol"` // "progressive" or "hls"
+		MimeType string `json:"mime_type"`
+	} `json:"format"`
+}
+
+type trackData struct {
+	Kind               string   `json:"kind"`
+	Id                 int64    `json:"id"`
+	Title              string   `json:"title"` // empty if the track is only a stub (in a set)
+	PermalinkUrl       string   `json:"permalink_url"`
+	Description        string   `json:"description"`
+	Duration           int      `json:"duration"` // in milliseconds
+	Policy             string   `json:"policy"`   // e.g. "ALLOW", "SNIP" or "BLOCK"
+	TrackAuthorization string   `json:"track_authorization"`
+	User               userData `json:"user"`
+	Media              struct {
+		Transcodings []transcoding `json:"transcodings"`
+	} `json:"media"`
+}
+
+// Returns the data of the track, without the streaming URL.
+func (d trackData) data() extractor.Data {
+	duration := -1
+	if d.Duration > 0 {
+		duration = d.Duration / 1000
+	}
+	return extractor.Data{
+		SourceUrl:   d.PermalinkUrl,
+		Title:       d.Title,
+		Description: d.Description,
+		Uploader:    d.User.Username,
+		Duration:    duration,
+	}
+}
+
+type playlistData struct {
+	Kind         string      `json:"kind"`
+	Id           int64       `json:"id"`
+	Title        string      `json:"title"`
+	PermalinkUrl string      `json:"permalink_url"`
+	User         userData    `json:"user"`
+	Tracks       []trackData `json:"tracks"`
+}
+
+type collectionData struct {
+	Collection []json.RawMessage `json:"collection"`
+	NextHref   string            `json:"next_href"`
+}
+
+// Returns the JSON describing the resource at the given soundcloud.com URL.
+func resolve(ctx context.Context, client *http.Client, resUrl string) (kind string, raw json.RawMessage, err error) {
+	if err := apiGet(ctx, client, apiUrl+"/resolve", url.Values{"url": {resUrl}}, &raw); err != nil {
+		return "", nil, err
+	}
+	var res struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return "", nil, ErrDecodingApiResponse
+	}
+	return res.Kind, raw, nil
+}
+
+// Returns the best transcoding for our purposes: Opus if possible, and
+// progressive (a single file) over HLS. Previews are never returned.
+func bestTranscoding(ts []transcoding) (transcoding, bool) {
+	score := func(t transcoding) int {
+		if t.Snipped || (t.Format.Protocol != "progressive" && t.Format.Protocol != "hls") {
+			return -1
+		}
+		s := 0
+		if strings.Contains(t.Format.MimeType, "opus") {
+			s += 2
+		}
+		if t.Format.Protocol == "progressive" {
+			s++
+		}
+		return s
+	}
+	best := -1
+	for i := range ts {
+		if score(ts[i]) >= 0 && (best == -1 || score(ts[i]) > score(ts[best])) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return transcoding{}, false
+	}
+	return ts[best], true
+}
+
+func getTrack(ctx context.Context, client *http.Client, track trackData) (extractor.Data, error) {
+	if track.Policy == "BLOCK" {
+		return extractor.Data{}, ErrTrackUnavailable
+	}
+	t, ok := bestTranscoding(track.Media.Transcodings)
+	if !ok {
+		return extractor.Data{}, ErrNoSuitableTranscoding
+	}
+
+	// The transcoding's URL only points to the actual streaming URL
+	var stream struct {
+		Url string `json:"url"`
+	}
+	query := url.Values{}
+	if track.TrackAuthorization != "" {
+		query.Set("track_authorization", track.TrackAuthorization)
+	}
+	if err := apiGet(ctx, client, t.Url, query, &stream); err != nil {
+		return extractor.Data{}, err
+	}
+	if stream.Url == "" {
+		return extractor.Data{}, ErrGettingTrackStreamingUrl
+	}
+
+	res := track.data()
+	res.StreamUrl = stream.Url
+	res.Expires = time.Now().Add(streamUrlLifetime)
+	return res, nil
+}
+
+// Fills in any tracks of a set which are only stubs (the API only returns the
+// first few tracks of a set in full).
+func completeTracks(ctx context.Context, client *http.Client, tracks []trackData) error {
+	var ids []string
+	for _, t := range tracks {
+		if t.Title == "" {
+			ids = append(ids, strconv.FormatInt(t.Id, 10))
+		}
+	}
+
+	full := make(map[int64]trackData, len(ids))
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxTracksPerRequest {
+			n = maxTracksPerRequest
+		}
+		var data []trackData
+		if err := apiGet(ctx, client, apiUrl+"/tracks", url.Values{"ids": {strings.Join(ids[:n], ",")}}, &data); err != nil {
+			return err
+		}
+		for _, t := range data {
+			full[t.Id] = t
+		}
+		ids = ids[n:]
+	}
+
+	for i, t := range tracks {
+		if t.Title == "" {
+			if f, ok := full[t.Id]; ok {
+				tracks[i] = f
+			}
+		}
+	}
+	return nil
+}
+
+// Only gets superficial data, the actual stream URL must be extracted from SourceUrl
+func getPlaylist(ctx context.Context, client *http.Client, playlist playlistData) ([]extractor.Data, error) {
+	if err := completeTracks(ctx, client, playlist.Tracks); err != nil {
+		return nil, err
+	}
+	var res []extractor.Data
+	for _, t := range playlist.Tracks {
+		if t.PermalinkUrl == "" {
+			// Not available anymore
+			continue
+		}
+		d := t.data()
+		d.PlaylistUrl = playlist.PermalinkUrl
+		d.PlaylistTitle = playlist.Title
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// Returns the user's most recent uploads (at most limit, unless limit is 0),
+// as a playlist. Only gets superficial data, the actual stream URL must be
+// extracted from SourceUrl.
+func getUserTracks(ctx context.Context, client *http.Client, user userData, limit int) ([]extractor.Data, error) {
+	var res []extractor.Data
+	next := apiUrl + "/users/" + strconv.FormatInt(user.Id, 10) + "/tracks"
+	query := url.Values{"limit": {strconv.Itoa(maxTracksPerRequest)}}
+	for next != "" && (limit == 0 || len(res) < limit) {
+		var data collectionData
+		if err := apiGet(ctx, client, next, query, &data); err != nil {
+			return nil, err
+		}
+		for _, raw := range data.Collection {
+			var t trackData
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, ErrDecodingApiResponse
+			}
+			d := t.data()
+			d.PlaylistUrl = user.PermalinkUrl
+			d.PlaylistTitle = user.Username
+			res = append(res, d)
+		}
+		next = data.NextHref
+	}
+	if limit != 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+func getSearch(ctx context.Context, client *http.Client, query string, limit int) ([]extractor.Data, error) {
+	var data collectionData
+	if err := apiGet(ctx, client, apiUrl+"/search", url.Values{
+		"q":     {query},
+		"limit": {strconv.Itoa(limit)},
+	}, &data); err != nil {
+		return nil, err
+	}
+
+	var res []extractor.Data
+	for _, raw := range data.Collection {
+		var item struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, ErrDecodingApiResponse
+		}
+		switch item.Kind {
+		case "track":
+			var t trackData
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return nil, ErrDecodingApiResponse
+			}
+			d := t.data()
+			d.Description = ""
+			d.Source = "SoundCloud"
+			res = append(res, d)
+		case "playlist":
+			var p playlistData
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, ErrDecodingApiResponse
+			}
+			res = append(res, extractor.Data{
+				PlaylistUrl:   p.PermalinkUrl,
+				PlaylistTitle: p.Title,
+				Source:        "SoundCloud",
+			})
+		}
+	}
+	return res, nil
+}
+
+func getSearchSuggestions(ctx context.Context, client *http.Client, query string) ([]string, error) {
+	var data struct {
+		Collection []struct {
+			Output string `json:"output"`
+		} `json:"collection"`
+	}
+	if err := apiGet(ctx, client, apiUrl+"/search/queries", url.Values{
+		"q":     {query},
+		"limit": {"10"},
+	}, &data); err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, v := range data.Collection {
+		res = append(res, v.Output)
+	}
+	return res, nil
+}
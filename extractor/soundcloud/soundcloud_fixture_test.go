@@ -0,0 +1,113 @@
+package soundcloud_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/soundcloud"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureSoundcloud(t *testing.T) {
+	cfg := fixture.Config(t)
+
+	// Opus over MP3, even though it's HLS
+	data, err := extractor.Extract(context.Background(), cfg, "https://soundcloud.com/fixture-band/prelude")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) == 1 {
+		fixture.CheckExpires(t, &data[0], 5*time.Minute)
+	}
+	prelude := extractor.Data{
+		SourceUrl:   "https://soundcloud.com/fixture-band/prelude",
+		Title:       "Prelude",
+		Description: "The first track.",
+		Uploader:    "Fixture Band",
+		Duration:    125,
+	}
+	expected := prelude
+	expected.StreamUrl = "https://cf-hls-opus-media.sndcdn.com/playlist/fixture/prelude.opus/playlist.m3u8?Policy=fixture&Signature=fixture"
+	fixture.CheckData(t, data, []extractor.Data{expected})
+
+	data, err = extractor.Extract(context.Background(), cfg, "https://soundcloud.com/fixture-band/slam")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) == 1 {
+		fixture.CheckExpires(t, &data[0], 5*time.Minute)
+	}
+	slam := extractor.Data{
+		SourceUrl: "https://soundcloud.com/fixture-band/slam",
+		Title:     "Slam",
+		Uploader:  "Fixture Band",
+		Duration:  251,
+	}
+	expected = slam
+	expected.StreamUrl = "https://cf-media.sndcdn.com/fixture-slam.128.mp3?Policy=fixture&Signature=fixture"
+	fixture.CheckData(t, data, []extractor.Data{expected})
+
+	// The set only contains stubs of its last two tracks, one of which isn't
+	// available anymore
+	loop := extractor.Data{
+		SourceUrl: "https://soundcloud.com/fixture-band/through-the-loop",
+		Title:     "Through the Loop",
+		Uploader:  "Fixture Band",
+		Duration:  297,
+	}
+	data, err = extractor.Extract(context.Background(), cfg, "https://soundcloud.com/fixture-band/sets/fixture-album")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	var expectedList []extractor.Data
+	for _, d := range []extractor.Data{prelude, slam, loop} {
+		d.PlaylistUrl = "https://soundcloud.com/fixture-band/sets/fixture-album"
+		d.PlaylistTitle = "Fixture Album"
+		expectedList = append(expectedList, d)
+	}
+	fixture.CheckData(t, data, expectedList)
+
+	// A user's tracks span two pages
+	data, err = extractor.Extract(context.Background(), cfg, "https://soundcloud.com/fixture-band")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expectedList = nil
+	for _, d := range []extractor.Data{prelude, slam, loop} {
+		d.PlaylistUrl = "https://soundcloud.com/fixture-band"
+		d.PlaylistTitle = "Fixture Band"
+		expectedList = append(expectedList, d)
+	}
+	fixture.CheckData(t, data, expectedList)
+
+	// Only the most recent upload, without getting the second page
+	cfg["soundcloud"]["max-user-tracks"] = int64(1)
+	data, err = extractor.Extract(context.Background(), cfg, "https://soundcloud.com/fixture-band")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, expectedList[:1])
+}
+
+func TestFixtureSoundcloudErrors(t *testing.T) {
+	cfg := fixture.Config(t)
+	cfg["youtube-dl"]["enabled"] = false
+
+	for _, c := range []struct {
+		url string
+		err error
+	}{
+		{"https://soundcloud.com/fixture-band/blocked", soundcloud.ErrTrackUnavailable},
+		{"https://soundcloud.com/fixture-band/preview", soundcloud.ErrNoSuitableTranscoding},
+	} {
+		_, err := extractor.Extract(context.Background(), cfg, c.url)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v: expected error '%v' but got '%v'", c.url, c.err, err)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package spotify
 
 import (
 	"git.nobrain.org/r4/dischord/extractor"
-	"git.nobrain.org/r4/dischord/extractor/youtube"
+	"git.nobrain.org/r4/dischord/extractor/match"
+	exutil "git.nobrain.org/r4/dischord/extractor/util"
 
+	"context"
 	"errors"
 	"net/url"
 	"strings"
@@ -20,53 +22,66 @@ const (
 	matchTypeTrack
 	matchTypeAlbum
 	matchTypePlaylist
+	matchTypeArtist
+	matchTypeShow
+	matchTypeEpisode
 )
 
 var (
 	ErrInvalidInput = errors.New("invalid input")
 )
 
+var matchTypeNames = map[matchType]string{
+	matchTypeTrack:    "track",
+	matchTypeAlbum:    "album",
+	matchTypePlaylist: "playlist",
+	matchTypeArtist:   "artist",
+	matchTypeShow:     "show",
+	matchTypeEpisode:  "episode",
+}
+
+// Accepts both links (optionally with a locale, e.g.
+// https://open.spotify.com/intl-de/track/<id>) and URIs (spotify:track:<id>).
 func matches(input string) (string, matchType) {
 	u, err := url.Parse(input)
 	if err != nil {
 		return "", matchTypeNone
 	}
-	if u.Scheme != "http" && u.Scheme != "https" {
-		return "", matchTypeNone
-	}
-	if u.Host != "open.spotify.com" {
+	var sp []string
+	switch u.Scheme {
+	case "spotify":
+		sp = strings.Split(u.Opaque, ":")
+	case "http", "https":
+		if u.Host != "open.spotify.com" {
+			return "", matchTypeNone
+		}
+		sp = strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+		if strings.HasPrefix(sp[0], "intl-") {
+			sp = sp[1:]
+		}
+	default:
 		return "", matchTypeNone
 	}
-	sp := strings.Split(u.Path, "/")
-	if len(sp) != 3 || sp[0] != "" {
+	if len(sp) != 2 || sp[1] == "" {
 		return "", matchTypeNone
 	}
-	switch sp[1] {
-	case "track":
-		return sp[2], matchTypeTrack
-	case "album":
-		return sp[2], matchTypeAlbum
-	case "playlist":
-		return sp[2], matchTypePlaylist
+	for m, name := range matchTypeNames {
+		if sp[0] == name {
+			return sp[1], m
+		}
 	}
 	return "", matchTypeNone
 }
 
 type Extractor struct {
-	ytSearcher        *youtube.Searcher
-	ytSearcherConfig  extractor.ProviderConfig
-	ytExtractor       *youtube.Extractor
-	ytExtractorConfig extractor.ProviderConfig
-	token             apiToken
+	matcher *match.Matcher
+	token   apiToken
 }
 
 func NewExtractor() *Extractor {
-	extractor := &Extractor{}
-	extractor.ytSearcher = &youtube.Searcher{}
-	extractor.ytSearcherConfig = extractor.ytSearcher.DefaultConfig()
-	extractor.ytExtractor = &youtube.Extractor{}
-	extractor.ytExtractorConfig = extractor.ytExtractor.DefaultConfig()
-	return extractor
+	return &Extractor{
+		matcher: match.NewMatcher("spotify"),
+	}
 }
 
 func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
@@ -78,19 +93,77 @@ func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
 	return m != matchTypeNone
 }
 
-func (e *Extractor) Extract(cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
 	id, m := matches(input)
 	switch m {
-	case matchTypeTrack:
-		d, err := getTrack(e, id)
+	case matchTypeTrack, matchTypeEpisode:
+		matchId, track, err := getMatchTrack(ctx, cfg, e, input)
+		if err != nil {
+			return nil, err
+		}
+		d, err := e.matcher.Get(ctx, cfg, matchId, track)
 		if err != nil {
 			return nil, err
 		}
+		if u, err := url.Parse(input); err == nil {
+			d.StartOffset = exutil.StartOffset(u)
+		}
 		return []extractor.Data{d}, nil
 	case matchTypeAlbum:
-		return getAlbum(e, id)
+		return getAlbum(ctx, cfg, e, id)
 	case matchTypePlaylist:
-		return getPlaylist(e, id)
+		return getPlaylist(ctx, cfg, e, id)
+	case matchTypeArtist:
+		return getArtist(ctx, cfg, e, id)
+	case matchTypeShow:
+		return getShow(ctx, cfg, e, id)
 	}
 	return nil, ErrInvalidInput
 }
+
+// Tracks and episodes are played from YouTube videos
+func (e *Extractor) MatchCandidates(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	_, track, err := getMatchTrack(ctx, cfg, e, input)
+	if err != nil {
+		return nil, err
+	}
+	return e.matcher.Candidates(ctx, cfg, track)
+}
+
+func (e *Extractor) FixMatch(ctx context.Context, cfg extractor.ProviderConfig, input, candidateUrl string) error {
+	matchId, ok := getMatchId(input)
+	if !ok {
+		return extractor.ErrNotMatched
+	}
+	return e.matcher.Fix(ctx, cfg, matchId, candidateUrl)
+}
+
+// Returns the ID the match for input is cached by (e.g. "track-<id>"), as long
+// as input is a single track or episode.
+func getMatchId(input string) (string, bool) {
+	id, m := matches(input)
+	if m != matchTypeTrack && m != matchTypeEpisode {
+		return "", false
+	}
+	return matchTypeNames[m] + "-" + id, true
+}
+
+// Returns the ID the match for input is cached by and the metadata to match.
+func getMatchTrack(ctx context.Context, cfg extractor.ProviderConfig, e *Extractor, input string) (string, match.Track, error) {
+	matchId, ok := getMatchId(input)
+	if !ok {
+		return "", match.Track{}, extractor.ErrNotMatched
+	}
+	var data trackData
+	var err error
+	switch id, m := matches(input); m {
+	case matchTypeTrack:
+		data, err = getTrackData(ctx, cfg, e, id)
+	case matchTypeEpisode:
+		data, err = getEpisodeData(ctx, cfg, e, id)
+	}
+	if err != nil {
+		return "", match.Track{}, err
+	}
+	return matchId, data.track(), nil
+}
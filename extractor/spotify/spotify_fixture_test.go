@@ -0,0 +1,163 @@
+package spotify_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/spotify"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+// The largest of the album's images
+const spotifyCover = "https://i.scdn.co/image/fixtureAlb1-640"
+
+func TestFixtureSpotifyTrack(t *testing.T) {
+	for _, input := range []string{
+		"https://open.spotify.com/track/fixtureTrk1",
+		"https://open.spotify.com/intl-de/track/fixtureTrk1",
+		"spotify:track:fixtureTrk1",
+	} {
+		data, err := extractor.Extract(context.Background(), fixture.Config(t), input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		if len(data) == 1 {
+			fixture.CheckExpires(t, &data[0], 21540*time.Second)
+		}
+		// The ISRC search finds the song, but the other song of the same
+		// name comes first
+		fixture.CheckData(t, data, []extractor.Data{{
+			SourceUrl:       "https://open.spotify.com/track/fixtureTrk1",
+			StreamUrl:       "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-music&n=edcb&itag=251&sig=IHJFEDCBA",
+			Title:           "Infected Mushroom, Ninet Tayeb - Black Velvet",
+			Uploader:        "Infected Mushroom, Ninet Tayeb",
+			Artist:          "Infected Mushroom, Ninet Tayeb",
+			Album:           "Head of NASA and the 2 Amish Boys",
+			Year:            2010,
+			Thumbnail:       spotifyCover,
+			Duration:        212,
+			MatchConfidence: 1,
+		}})
+	}
+
+	// Neither the ISRC nor the names turn up anything on YouTube Music, and
+	// regular YouTube only has other songs by the artist; the best of them is
+	// used, but it's flagged as unlikely to be right
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://open.spotify.com/track/fixtureTrk2")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) == 1 {
+		fixture.CheckExpires(t, &data[0], 21540*time.Second)
+		if c := data[0].MatchConfidence; c <= 0 || c >= 0.5 {
+			t.Errorf("Expected a low match confidence but got %v", c)
+		}
+		data[0].MatchConfidence = 0
+	}
+	fixture.CheckData(t, data, []extractor.Data{{
+		SourceUrl: "https://open.spotify.com/track/fixtureTrk2",
+		StreamUrl: "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-music&n=edcb&itag=251&sig=IHJFEDCBA",
+		Title:     "Infected Mushroom - While I'm in the Mood",
+		Uploader:  "Infected Mushroom",
+		Artist:    "Infected Mushroom",
+		Album:     "Vicious Delicious",
+		Year:      2007,
+		Duration:  212,
+	}})
+}
+
+func TestFixtureSpotifyArtist(t *testing.T) {
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "spotify:artist:fixtureArt1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	top := fixture.Playlist{Url: "https://open.spotify.com/artist/fixtureArt1", Title: "Infected Mushroom - Top Tracks"}
+	fixture.CheckData(t, data, []extractor.Data{
+		top.Track("https://open.spotify.com/track/fixtureTrk1", "Infected Mushroom, Ninet Tayeb - Black Velvet", "Infected Mushroom, Ninet Tayeb", 260),
+		top.Track("https://open.spotify.com/track/fixtureTrk2", "Infected Mushroom - While I'm in the Mood", "Infected Mushroom", 397),
+	})
+}
+
+func TestFixtureSpotifyShow(t *testing.T) {
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://open.spotify.com/show/fixtureShw1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	show := fixture.Playlist{Url: "https://open.spotify.com/show/fixtureShw1", Title: "Fixture Podcast"}
+	// Only the newer episode has its release date in the fixture
+	newest := show.Entry("https://open.spotify.com/episode/fixtureEp2", "Fixture Podcast - Episode Two", "Fixture Media", 1800)
+	newest.Year = 2023
+	fixture.CheckData(t, data, []extractor.Data{
+		newest,
+		show.Entry("https://open.spotify.com/episode/fixtureEp1", "Fixture Podcast - Episode One", "Fixture Media", 212),
+	})
+
+	// Episodes are looked up on YouTube like tracks
+	data, err = extractor.Extract(context.Background(), fixture.Config(t), "https://open.spotify.com/intl-fr/episode/fixtureEp1?t=60")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) == 1 {
+		fixture.CheckExpires(t, &data[0], 21540*time.Second)
+	}
+	fixture.CheckData(t, data, []extractor.Data{{
+		SourceUrl:       "https://open.spotify.com/episode/fixtureEp1",
+		StreamUrl:       "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-video&itag=251",
+		Title:           "Fixture Podcast - Episode One",
+		Uploader:        "Fixture Podcast",
+		Artist:          "Fixture Podcast",
+		Year:            2023,
+		Thumbnail:       "https://i.scdn.co/image/fixtureEp1-640",
+		Duration:        212,
+		StartOffset:     60,
+		MatchConfidence: 1,
+	}})
+}
+
+func TestFixtureSpotifyAlbum(t *testing.T) {
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://open.spotify.com/album/fixtureAlb1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	album := fixture.Playlist{Url: "https://open.spotify.com/album/fixtureAlb1", Title: "Head of NASA and the 2 Amish Boys"}
+	fixture.CheckData(t, data, []extractor.Data{
+		fixture.FromAlbum(album.Track("https://open.spotify.com/track/fixtureTrk1", "Infected Mushroom, Ninet Tayeb - Black Velvet", "Infected Mushroom, Ninet Tayeb", 260), album.Title, 2010, spotifyCover),
+		fixture.FromAlbum(album.Track("https://open.spotify.com/track/fixtureTrk2", "Infected Mushroom - While I'm in the Mood", "Infected Mushroom", 301), album.Title, 2010, spotifyCover),
+		fixture.FromAlbum(album.Track("https://open.spotify.com/track/fixtureTrk3", "Infected Mushroom, Ninet Tayeb - Fields of Grey", "Infected Mushroom, Ninet Tayeb", 284), album.Title, 2010, spotifyCover),
+	})
+}
+
+func TestFixtureSpotifyPlaylist(t *testing.T) {
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://open.spotify.com/playlist/fixturePls1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	pls := fixture.Playlist{Url: "https://open.spotify.com/playlist/fixturePls1", Title: "Fixture Mix"}
+	// Only the first track has its album in the fixture
+	fixture.CheckData(t, data, []extractor.Data{
+		fixture.FromAlbum(pls.Track("https://open.spotify.com/track/fixtureTrk3", "Infected Mushroom, Ninet Tayeb - Fields of Grey", "Infected Mushroom, Ninet Tayeb", 284), "Head of NASA and the 2 Amish Boys", 2010, spotifyCover),
+		pls.Track("https://open.spotify.com/track/fixtureTrk2", "Infected Mushroom - While I'm in the Mood", "Infected Mushroom", 301),
+		pls.Track("https://open.spotify.com/track/fixtureTrk1", "Infected Mushroom, Ninet Tayeb - Black Velvet", "Infected Mushroom, Ninet Tayeb", 260),
+	})
+}
+
+func TestFixtureSpotifyErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   error
+	}{
+		{"https://open.spotify.com/track/fixtureMissing", spotify.ErrInvalidTrackData},
+		{"https://open.spotify.com/track/fixtureLimited", spotify.ErrDecodingApiResponse},
+		{"spotify:episode:fixtureMissing", spotify.ErrInvalidEpisodeData},
+	} {
+		_, err := extractor.Extract(context.Background(), fixture.Config(t), test.input)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.input, test.err, err)
+		}
+	}
+}
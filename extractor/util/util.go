@@ -1,14 +1,29 @@
 package util
 
 import (
+	"git.nobrain.org/r4/dischord/util"
+
 	"golang.org/x/net/html"
 
+	"context"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
+// Like client.Get, but cancelled once ctx is done
+func HttpGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
 // Retrieve JavaScript embedded in HTML
-func GetHTMLScriptFunc(url string, readCodeLineByLine bool, codeFunc func(code string) bool) error {
-	resp, err := http.Get(url)
+func GetHTMLScriptFunc(ctx context.Context, client *http.Client, url string, readCodeLineByLine bool, codeFunc func(code string) bool) error {
+	resp, err := HttpGet(ctx, client, url)
 	if err != nil {
 		return err
 	}
@@ -57,3 +72,82 @@ func GetHTMLScriptFunc(url string, readCodeLineByLine bool, codeFunc func(code s
 		}
 	}
 }
+
+// Calls attrFunc with the attributes of each HTML element with the given tag
+// name, until attrFunc returns false
+func GetHTMLAttrsFunc(ctx context.Context, client *http.Client, url string, tag string, attrFunc func(attrs map[string]string) bool) error {
+	resp, err := HttpGet(ctx, client, url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	z := html.NewTokenizer(resp.Body)
+
+	for {
+		tt := z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			return z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tn, hasAttr := z.TagName()
+			if string(tn) != tag {
+				continue
+			}
+			attrs := make(map[string]string)
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+			if !attrFunc(attrs) {
+				return nil
+			}
+		}
+	}
+}
+
+// Returns the time (in seconds) a URL says playback should start at, or 0 if
+// it doesn't say. Understands the query parameters t and start as well as
+// fragments like #t=93 or #1:33 (as used by Spotify). Timestamps may be given
+// in seconds (93), YouTube style (1m33s) or as a duration (1:33).
+func StartOffset(u *url.URL) int {
+	q := u.Query()
+	for _, s := range []string{q.Get("t"), q.Get("start"), strings.TrimPrefix(u.Fragment, "t=")} {
+		if s == "" {
+			continue
+		}
+		if secs, err := parseTimestamp(s); err == nil {
+			return secs
+		}
+	}
+	return 0
+}
+
+func parseTimestamp(s string) (int, error) {
+	if !strings.ContainsAny(s, "hms") {
+		return util.ParseDurationSeconds(s)
+	}
+	// e.g. 1h2m3s
+	var secs int
+	for _, unit := range []struct {
+		suffix string
+		secs   int
+	}{{"h", 3600}, {"m", 60}, {"s", 1}} {
+		i := strings.Index(s, unit.suffix)
+		if i == -1 {
+			continue
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil || n < 0 {
+			return 0, strconv.ErrSyntax
+		}
+		secs += n * unit.secs
+		s = s[i+1:]
+	}
+	if s != "" {
+		return 0, strconv.ErrSyntax
+	}
+	return secs, nil
+}
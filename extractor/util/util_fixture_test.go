@@ -0,0 +1,38 @@
+package util_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+
+	"context"
+
+	"testing"
+)
+
+func TestFixtureStartOffset(t *testing.T) {
+	cfg := fixture.Config(t)
+	for _, input := range []string{
+		"https://youtu.be/fixtureVid1?t=93",
+		"https://www.youtube.com/watch?v=fixtureVid1&t=1m33s",
+		"https://www.youtube.com/watch?v=fixtureVid1&start=93",
+		"https://open.spotify.com/track/fixtureTrk1#1:33",
+		"https://open.spotify.com/track/fixtureTrk1#t=93",
+	} {
+		data, err := extractor.Extract(context.Background(), cfg, input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		if len(data) != 1 || data[0].StartOffset != 93 {
+			t.Errorf("%v: expected a start offset of 93 seconds but got %+v", input, data)
+		}
+	}
+
+	data, err := extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixtureVid1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 1 || data[0].StartOffset != 0 {
+		t.Errorf("Expected no start offset but got %+v", data)
+	}
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"net/url"
+
+	"testing"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected int
+		valid    bool
+	}{
+		{"93", 93, true},
+		{"1:33", 93, true},
+		{"1:01:33", 3693, true},
+		{"1m33s", 93, true},
+		{"1h", 3600, true},
+		{"1h1m33s", 3693, true},
+		{"33s", 33, true},
+		{"", 0, false},
+		{"1m33", 0, false},
+		{"1s1m", 0, false},
+		{"-1m", 0, false},
+		{"a:b", 0, false},
+	} {
+		res, err := parseTimestamp(test.input)
+		if (err == nil) != test.valid {
+			t.Errorf("%q: expected valid=%v but got error '%v'", test.input, test.valid, err)
+		} else if res != test.expected {
+			t.Errorf("%q: expected %v but got %v", test.input, test.expected, res)
+		}
+	}
+}
+
+func TestStartOffset(t *testing.T) {
+	for _, test := range []struct {
+		input    string
+		expected int
+	}{
+		{"https://youtu.be/fixtureVid1?t=93", 93},
+		{"https://www.youtube.com/watch?v=fixtureVid1&t=1m33s", 93},
+		{"https://www.youtube.com/watch?v=fixtureVid1&start=93", 93},
+		{"https://open.spotify.com/track/fixtureTrk1#1:33", 93},
+		{"https://open.spotify.com/track/fixtureTrk1#t=93", 93},
+		{"https://www.youtube.com/watch?v=fixtureVid1", 0},
+		// Invalid ones are skipped
+		{"https://www.youtube.com/watch?v=fixtureVid1&t=soon&start=93", 93},
+		{"https://www.youtube.com/watch?v=fixtureVid1&t=soon", 0},
+	} {
+		u, err := url.Parse(test.input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", test.input, err)
+		}
+		if res := StartOffset(u); res != test.expected {
+			t.Errorf("%v: expected %v but got %v", test.input, test.expected, res)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package youtube
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrInnertubeRequestFailed = errors.New("InnerTube API request failed")
+	ErrUnknownInnertubeClient = errors.New("unknown InnerTube client (available: web, android, ios, tv-embedded)")
+)
+
+const baseUrl = "https://www.youtube.com"
+
+// A client InnerTube (the API YouTube's own apps use) can be asked as. They
+// differ in what they get: e.g. only the web clients' stream URLs come with
+// encrypted signatures, but some videos are only playable on the web.
+type innertubeClient struct {
+	name      string // as in the requests
+	version   string
+	id        string // numeric ID used in the X-YouTube-Client-Name header
+	userAgent string // uses the Go default if empty
+	// Additional values of the client context (device info etc.)
+	extra map[string]any
+	// Whether the client acts as a player embedded on another site, which
+	// gets around some age restrictions
+	embedded bool
+	// Whether stream URLs may have encrypted signatures (see decryptor)
+	ciphered bool
+}
+
+// Clients that can be selected in the config.
+var innertubeClients = map[string]innertubeClient{
+	"web": {
+		name:     "WEB",
+		version:  "2.20240101.00.00",
+		id:       "1",
+		ciphered: true,
+	},
+	"android": {
+		name:      "ANDROID",
+		version:   "19.09.37",
+		id:        "3",
+		userAgent: "com.google.android.youtube/19.09.37 (Linux; U; Android 11) gzip",
+		extra: map[string]any{
+			"androidSdkVersion": 30,
+			"osName":            "Android",
+			"osVersion":         "11",
+		},
+	},
+	"ios": {
+		name:      "IOS",
+		version:   "19.09.3",
+		id:        "5",
+		userAgent: "com.google.ios.youtube/19.09.3 (iPhone14,3; U; CPU iOS 15_6 like Mac OS X)",
+		extra: map[string]any{
+			"deviceMake":  "Apple",
+			"deviceModel": "iPhone14,3",
+			"osName":      "iPhone",
+			"osVersion":   "15.6.0.19G71",
+		},
+	},
+	"tv-embedded": {
+		name:     "TVHTML5_SIMPLY_EMBEDDED_PLAYER",
+		version:  "2.0",
+		id:       "85",
+		embedded: true,
+		ciphered: true,
+	},
+}
+
+// Used for everything but getting the stream URLs, as the web client's
+// responses are what our data structures are modeled after.
+var webClient = innertubeClients["web"]
+
+// YouTube Music's web app; only used with musicBaseUrl.
+var musicClient = innertubeClient{
+	name:    "WEB_REMIX",
+	version: "1.20240101.01.00",
+	id:      "67",
+}
+
+// Parses a comma separated list of client names (as in the config).
+func parseInnertubeClients(s string) ([]innertubeClient, error) {
+	var res []innertubeClient
+	for _, name := range strings.Split(s, ",") {
+		c, ok := innertubeClients[strings.TrimSpace(name)]
+		if !ok {
+			return nil, ErrUnknownInnertubeClient
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+// Sends a request to the InnerTube endpoint at base (e.g. baseUrl or
+// musicBaseUrl) as the given client and decodes the response into v.
+func innertubePost(ctx context.Context, client *http.Client, base string, c innertubeClient, endpoint string, body map[string]any, v any) error {
+	clientCtx := map[string]any{
+		"clientName":    c.name,
+		"clientVersion": c.version,
+		"hl":            "en",
+	}
+	for k, v := range c.extra {
+		clientCtx[k] = v
+	}
+	reqCtx := map[string]any{
+		"client": clientCtx,
+	}
+	if c.embedded {
+		reqCtx["thirdParty"] = map[string]any{
+			"embedUrl": baseUrl + "/",
+		}
+	}
+	body["context"] = reqCtx
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/youtubei/v1/"+endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", base)
+	req.Header.Set("X-YouTube-Client-Name", c.id)
+	req.Header.Set("X-YouTube-Client-Version", c.version)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ErrInnertubeRequestFailed
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return ErrMalformedJson
+	}
+	return nil
+}
@@ -3,13 +3,16 @@ package youtube
 import (
 	"git.nobrain.org/r4/dischord/extractor"
 
+	"context"
 	"errors"
 	"net/url"
+	"strings"
 )
 
 func init() {
 	extractor.AddExtractor("youtube", &Extractor{})
 	extractor.AddSearcher("youtube-search", &Searcher{})
+	extractor.AddSearcher("youtube-music-search", &MusicSearcher{})
 	extractor.AddSuggestor("youtube-search-suggestions", &Suggestor{})
 }
 
@@ -19,6 +22,8 @@ const (
 	matchTypeNone matchType = iota
 	matchTypeVideo
 	matchTypePlaylist
+	matchTypeMusicAlbum
+	matchTypeChannel
 )
 
 var (
@@ -38,14 +43,33 @@ func matches(requireDirectPlaylistUrl bool, input string) matchType {
 		return matchTypeNone
 	}
 	switch u.Host {
-	case "www.youtube.com", "youtube.com":
-		if u.Path != "/watch" && u.Path != "/playlist" {
+	case "www.youtube.com", "youtube.com", "music.youtube.com":
+		if u.Host == "music.youtube.com" && strings.HasPrefix(u.Path, "/browse/") {
+			switch {
+			case strings.HasPrefix(u.Path, "/browse/VL"):
+				return matchTypePlaylist
+			case strings.HasPrefix(u.Path, "/browse/MPREb_"):
+				return matchTypeMusicAlbum
+			}
 			return matchTypeNone
 		}
-		if q.Has("list") && (!requireDirectPlaylistUrl || u.Path == "/playlist") {
-			return matchTypePlaylist
+		if u.Path == "/watch" || u.Path == "/playlist" {
+			if q.Has("list") && (!requireDirectPlaylistUrl || u.Path == "/playlist") {
+				return matchTypePlaylist
+			}
+			return matchTypeVideo
 		}
-		return matchTypeVideo
+		sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+		switch {
+		case (sp[0] == "shorts" || sp[0] == "live") && len(sp) == 2 && sp[1] != "":
+			return matchTypeVideo
+		// /@<handle> or /channel/<id>, optionally followed by /videos
+		case strings.HasPrefix(sp[0], "@") && len(sp[0]) > 1 && (len(sp) == 1 || (len(sp) == 2 && sp[1] == "videos")):
+			return matchTypeChannel
+		case sp[0] == "channel" && len(sp) >= 2 && sp[1] != "" && (len(sp) == 2 || (len(sp) == 3 && sp[2] == "videos")):
+			return matchTypeChannel
+		}
+		return matchTypeNone
 	case "youtu.be":
 		return matchTypeVideo
 	default:
@@ -53,6 +77,33 @@ func matches(requireDirectPlaylistUrl bool, input string) matchType {
 	}
 }
 
+// Converts URLs of the same video or playlist to the form the rest of the
+// extractor works with (e.g. YouTube Music and shorts URLs to regular
+// watch URLs). Other URLs are returned unchanged.
+func canonicalUrl(input string) string {
+	u, err := url.Parse(input)
+	if err != nil {
+		return input
+	}
+	switch u.Host {
+	case "music.youtube.com":
+		if listId := strings.TrimPrefix(u.Path, "/browse/VL"); listId != u.Path {
+			return "https://www.youtube.com/playlist?list=" + listId
+		}
+		if u.Path == "/watch" || u.Path == "/playlist" {
+			u.Host = "www.youtube.com"
+			return u.String()
+		}
+	case "www.youtube.com", "youtube.com":
+		for _, prefix := range []string{"/shorts/", "/live/"} {
+			if id := strings.TrimPrefix(u.Path, prefix); id != u.Path {
+				return "https://www.youtube.com/watch?v=" + strings.Trim(id, "/")
+			}
+		}
+	}
+	return input
+}
+
 type Extractor struct {
 	decryptor decryptor
 }
@@ -60,6 +111,13 @@ type Extractor struct {
 func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
 	return extractor.ProviderConfig{
 		"require-direct-playlist-url": false,
+		// InnerTube clients (web, android, ios, tv-embedded) to get stream
+		// URLs as, in the order they're tried
+		"innertube-clients": "android,ios,web",
+		// Only the most recent uploads of a channel are added
+		"max-channel-videos": int64(50),
+		// Mixes go on forever, so they're cut off after this many videos
+		"max-mix-videos": int64(25),
 	}
 }
 
@@ -67,28 +125,74 @@ func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
 	return matches(cfg["require-direct-playlist-url"].(bool), input) != matchTypeNone
 }
 
-func (e *Extractor) Extract(cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	var res []extractor.Data
+	err := e.ExtractFunc(ctx, cfg, input, func(data []extractor.Data) error {
+		res = append(res, data...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (e *Extractor) ExtractFunc(ctx context.Context, cfg extractor.ProviderConfig, input string, fn func([]extractor.Data) error) error {
+	input = canonicalUrl(input)
 	switch matches(cfg["require-direct-playlist-url"].(bool), input) {
 	case matchTypeVideo:
-		d, err := getVideo(&e.decryptor, input)
+		clients, err := parseInnertubeClients(cfg["innertube-clients"].(string))
+		if err != nil {
+			return err
+		}
+		d, err := getVideo(ctx, extractor.HttpClient(cfg), extractor.ProviderCache(cfg), &e.decryptor, clients, input)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		return []extractor.Data{d}, nil
+		return fn([]extractor.Data{d})
 	case matchTypePlaylist:
-		return getPlaylist(input)
+		limit := 0
+		if isMix(input) {
+			// 0 would mean forever, so only play the video the mix is based on
+			limit = int(cfg["max-mix-videos"].(int64))
+			if limit <= 0 {
+				limit = 1
+			}
+		}
+		return getPlaylistFunc(ctx, extractor.HttpClient(cfg), input, limit, fn)
+	case matchTypeChannel:
+		return getChannelFunc(ctx, extractor.HttpClient(cfg), input, int(cfg["max-channel-videos"].(int64)), fn)
+	case matchTypeMusicAlbum:
+		return getMusicAlbumFunc(ctx, extractor.HttpClient(cfg), input, fn)
 	}
-	return nil, ErrInvalidInput
+	return ErrInvalidInput
 }
 
 type Searcher struct{}
 
 func (s *Searcher) DefaultConfig() extractor.ProviderConfig {
-	return extractor.ProviderConfig{}
+	return extractor.ProviderConfig{
+		"search-prefix": "yt",
+	}
+}
+
+func (s *Searcher) Search(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	return getSearch(ctx, extractor.HttpClient(cfg), input)
+}
+
+// Like Searcher, but only finds songs on YouTube Music.
+type MusicSearcher struct{}
+
+func (s *MusicSearcher) DefaultConfig() extractor.ProviderConfig {
+	return extractor.ProviderConfig{
+		"search-prefix": "ytm",
+		// Show regular YouTube results first
+		"priority": int64(-1),
+	}
 }
 
-func (s *Searcher) Search(cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
-	return getSearch(input)
+func (s *MusicSearcher) Search(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+	return getMusicSearch(ctx, extractor.HttpClient(cfg), input)
 }
 
 type Suggestor struct{}
@@ -97,6 +201,6 @@ func (s *Suggestor) DefaultConfig() extractor.ProviderConfig {
 	return extractor.ProviderConfig{}
 }
 
-func (s *Suggestor) Suggest(cfg extractor.ProviderConfig, input string) ([]string, error) {
-	return getSearchSuggestions(input)
+func (s *Suggestor) Suggest(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]string, error) {
+	return getSearchSuggestions(ctx, extractor.HttpClient(cfg), input)
 }
@@ -5,8 +5,10 @@ import (
 	exutil "git.nobrain.org/r4/dischord/extractor/util"
 	"git.nobrain.org/r4/dischord/util"
 
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -20,28 +22,48 @@ var (
 	ErrGettingUrlFromSignatureCipher = errors.New("error getting URL from signature cipher")
 	ErrDecryptFunctionBroken         = errors.New("signature decryptor function is broken (perhaps the extractor is out of date)")
 	ErrMalformedJson                 = errors.New("malformed JSON")
+	ErrUnplayable                    = errors.New("video is unplayable")
+	ErrVideoUnavailable              = fmt.Errorf("%w: video doesn't exist or was removed", extractor.ErrUnavailable)
+	ErrVideoPrivate                  = fmt.Errorf("%w: video is private", extractor.ErrUnavailable)
+	ErrAgeRestricted                 = fmt.Errorf("%w: video is age-restricted", extractor.ErrUnavailable)
+	ErrStreamUrlRejected             = errors.New("stream URL was rejected by YouTube")
+	ErrChannelNotFound               = errors.New("unable to find the channel")
 )
 
+type playabilityStatus struct {
+	Status string `json:"status"` // "OK" if playable
+	Reason string `json:"reason"`
+}
+
+// Returns nil if the video is playable. Some of the reasons only apply to the
+// client that asked (e.g. embedding being disabled) or are YouTube getting
+// suspicious, so only the ones which apply to everyone wrap
+// extractor.ErrUnavailable.
+func (s playabilityStatus) err() error {
+	reason := strings.ToLower(s.Reason)
+	switch {
+	case s.Status == "OK":
+		return nil
+	case s.Status == "ERROR":
+		return ErrVideoUnavailable
+	case s.Status == "LOGIN_REQUIRED" && strings.Contains(reason, "private"):
+		return ErrVideoPrivate
+	case s.Status == "AGE_CHECK_REQUIRED" || s.Status == "AGE_VERIFICATION_REQUIRED" ||
+		(s.Status == "LOGIN_REQUIRED" && strings.Contains(reason, "confirm your age")):
+		return ErrAgeRestricted
+	}
+	return fmt.Errorf("%w: %v", ErrUnplayable, s.Reason)
+}
+
 type playerData struct {
-	StreamingData struct {
+	PlayabilityStatus playabilityStatus `json:"playabilityStatus"`
+	StreamingData     struct {
 		ExpiresInSeconds string `json:"expiresInSeconds"`
-		Formats          []struct {
-			Url              string `json:"url"`
-			SignatureCipher  string `json:"signatureCipher"`
-			MimeType         string `json:"mimeType"`
-			Bitrate          int    `json:"bitrate"`
-			ApproxDurationMs string `json:"approxDurationMs"`
-			AudioSampleRate  string `json:"audioSampleRate"`
-			AudioChannels    int    `json:"audioChannels"`
-		} `json:"formats"`
-		AdaptiveFormats []struct {
-			Url              string `json:"url"`
-			SignatureCipher  string `json:"signatureCipher"`
-			MimeType         string `json:"mimeType"`
-			Bitrate          int    `json:"bitrate"`
-			ApproxDurationMs string `json:"approxDurationMs"`
-			AudioSampleRate  string `json:"audioSampleRate"`
-			AudioChannels    int    `json:"audioChannels"`
+		AdaptiveFormats  []struct {
+			Url             string `json:"url"`
+			SignatureCipher string `json:"signatureCipher"`
+			MimeType        string `json:"mimeType"`
+			Bitrate         int    `json:"bitrate"`
 		} `json:"adaptiveFormats"`
 	} `json:"streamingData"`
 	VideoDetails struct {
@@ -50,102 +72,304 @@ type playerData struct {
 		LengthSeconds    string `json:"lengthSeconds"`
 		ShortDescription string `json:"shortDescription"`
 		Author           string `json:"author"`
+		ViewCount        string `json:"viewCount"`
+		IsLive           bool   `json:"isLive"`
 	} `json:"videoDetails"`
+	Microformat struct {
+		PlayerMicroformatRenderer struct {
+			PublishDate string `json:"publishDate"` // e.g. "2010-05-04"
+		} `json:"playerMicroformatRenderer"`
+	} `json:"microformat"`
 }
 
-func getVideo(decryptor *decryptor, vUrl string) (extractor.Data, error) {
-	try := func() (extractor.Data, error) {
-		// Get JSON string from YouTube
-		v, err := getJSVar(vUrl, "ytInitialPlayerResponse")
-		if err != nil {
+// Every video has its thumbnail at the same place, so it doesn't have to be
+// looked for in the responses.
+func thumbnailUrl(vidId string) string {
+	return "https://i.ytimg.com/vi/" + vidId + "/mqdefault.jpg"
+}
+
+// Auto-generated "Topic" channels are named after the artist.
+func topicArtist(uploader string) string {
+	if strings.HasSuffix(uploader, " - Topic") {
+		return strings.TrimSuffix(uploader, " - Topic")
+	}
+	return ""
+}
+
+// Gets the video ID out of a watch or youtu.be URL.
+func getVideoId(vUrl string) (string, error) {
+	u, err := url.Parse(vUrl)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "youtu.be" {
+		return strings.Trim(u.Path, "/"), nil
+	}
+	return u.Query().Get("v"), nil
+}
+
+// Asks each of the clients in turn for the video's stream URL until one of
+// them gives us one that works. If none do, the first error is returned.
+func getVideo(ctx context.Context, client *http.Client, cache extractor.Cache, decryptor *decryptor, clients []innertubeClient, vUrl string) (extractor.Data, error) {
+	id, err := getVideoId(vUrl)
+	if err != nil {
+		return extractor.Data{}, err
+	}
+
+	var firstErr error
+	for _, c := range clients {
+		data, err := getVideoAs(ctx, client, cache, decryptor, c, id)
+		if err == nil {
+			data.SourceUrl = vUrl
+			if u, err := url.Parse(vUrl); err == nil {
+				data.StartOffset = exutil.StartOffset(u)
+			}
+			return data, nil
+		}
+		if errors.Is(err, extractor.ErrUnavailable) {
+			// Other clients won't get it either
 			return extractor.Data{}, err
 		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return extractor.Data{}, firstErr
+}
 
-		// Parse player data scraped from YouTube
-		var data playerData
-		if err := json.Unmarshal([]byte(v), &data); err != nil {
+func getVideoAs(ctx context.Context, client *http.Client, cache extractor.Cache, decryptor *decryptor, c innertubeClient, id string) (extractor.Data, error) {
+	body := map[string]any{
+		"videoId":        id,
+		"contentCheckOk": true,
+		"racyCheckOk":    true,
+	}
+	if c.ciphered {
+		sts, err := decryptor.getSignatureTimestamp(ctx, client, cache)
+		if err != nil {
 			return extractor.Data{}, err
 		}
-
-		// Get audio format with maximum bitrate
-		maxBr := -1
-		for i, f := range data.StreamingData.AdaptiveFormats {
-			if strings.HasPrefix(f.MimeType, "audio/") {
-				if maxBr == -1 || f.Bitrate > data.StreamingData.AdaptiveFormats[maxBr].Bitrate {
-					maxBr = i
-				}
+		if sts != 0 {
+			body["playbackContext"] = map[string]any{
+				"contentPlaybackContext": map[string]any{
+					"signatureTimestamp": sts,
+				},
 			}
 		}
-		if maxBr == -1 {
-			return extractor.Data{}, ErrNoSuitableFormat
+	}
+
+	var data playerData
+	if err := innertubePost(ctx, client, baseUrl, c, "player", body, &data); err != nil {
+		return extractor.Data{}, err
+	}
+	if err := data.PlayabilityStatus.err(); err != nil {
+		return extractor.Data{}, err
+	}
+
+	// Get audio format with maximum bitrate
+	maxBr := -1
+	for i, f := range data.StreamingData.AdaptiveFormats {
+		if strings.HasPrefix(f.MimeType, "audio/") {
+			if maxBr == -1 || f.Bitrate > data.StreamingData.AdaptiveFormats[maxBr].Bitrate {
+				maxBr = i
+			}
 		}
+	}
+	if maxBr == -1 {
+		return extractor.Data{}, ErrNoSuitableFormat
+	}
+
+	duration, err := strconv.Atoi(data.VideoDetails.LengthSeconds)
+	if err != nil {
+		duration = -1
+	}
+	expires, err := strconv.Atoi(data.StreamingData.ExpiresInSeconds)
+	if err != nil {
+		return extractor.Data{}, err
+	}
 
-		duration, err := strconv.Atoi(data.VideoDetails.LengthSeconds)
+	ft := data.StreamingData.AdaptiveFormats[maxBr]
+	var resUrl string
+	if ft.Url != "" {
+		resUrl = ft.Url
+	} else {
+		// For music, YouTube makes getting the resource URL a bit trickier
+		q, err := url.ParseQuery(ft.SignatureCipher)
 		if err != nil {
-			duration = -1
+			return extractor.Data{}, ErrGettingUrlFromSignatureCipher
 		}
-		expires, err := strconv.Atoi(data.StreamingData.ExpiresInSeconds)
+		sig := q.Get("s")
+		sigParam := q.Get("sp")
+		streamBaseUrl := q.Get("url")
+		sigDecrypted, err := decryptor.decrypt(ctx, client, cache, sig)
 		if err != nil {
 			return extractor.Data{}, err
 		}
+		resUrl = streamBaseUrl + "&" + sigParam + "=" + sigDecrypted
+	}
+	if c.ciphered {
+		// The n parameter only affects how fast the stream is, so it's left
+		// alone if it can't be transformed
+		if u, err := transformNParam(ctx, client, cache, decryptor, resUrl); err == nil {
+			resUrl = u
+		}
+	}
 
-		ft := data.StreamingData.AdaptiveFormats[maxBr]
-		var resUrl string
-		if ft.Url != "" {
-			resUrl = ft.Url
-		} else {
-			// For music, YouTube makes getting the resource URL a bit trickier
-			q, err := url.ParseQuery(ft.SignatureCipher)
+	// Stream URLs are sometimes rejected, e.g. if a client is no longer
+	// allowed to get them or if decrypting the signature went wrong
+	if !streamUrlWorks(ctx, client, resUrl) {
+		if err := ctx.Err(); err != nil {
+			return extractor.Data{}, err
+		}
+		if ft.Url == "" {
+			decryptor.expire()
+			return extractor.Data{}, ErrDecryptFunctionBroken
+		}
+		return extractor.Data{}, ErrStreamUrlRejected
+	}
+
+	views, _ := strconv.ParseInt(data.VideoDetails.ViewCount, 10, 64)
+	year := 0
+	if date := data.Microformat.PlayerMicroformatRenderer.PublishDate; len(date) >= 4 {
+		year, _ = strconv.Atoi(date[:4])
+	}
+
+	return extractor.Data{
+		StreamUrl:   resUrl,
+		Title:       data.VideoDetails.Title,
+		Description: data.VideoDetails.ShortDescription,
+		Uploader:    data.VideoDetails.Author,
+		Artist:      topicArtist(data.VideoDetails.Author),
+		Year:        year,
+		Thumbnail:   thumbnailUrl(id),
+		Views:       views,
+		IsLive:      data.VideoDetails.IsLive,
+		Duration:    duration,
+		Expires:     time.Now().Add(time.Duration(expires) * time.Second),
+	}, nil
+}
+
+// Replaces the n parameter in strmUrl in place, so the rest of the URL stays
+// as is.
+func transformNParam(ctx context.Context, client *http.Client, cache extractor.Cache, decryptor *decryptor, strmUrl string) (string, error) {
+	base, rawQuery, ok := strings.Cut(strmUrl, "?")
+	if !ok {
+		return strmUrl, nil
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, p := range params {
+		if strings.HasPrefix(p, "n=") {
+			n, err := url.QueryUnescape(p[len("n="):])
 			if err != nil {
-				return extractor.Data{}, ErrGettingUrlFromSignatureCipher
+				return "", err
 			}
-			sig := q.Get("s")
-			sigParam := q.Get("sp")
-			baseUrl := q.Get("url")
-			sigDecrypted, err := decryptor.decrypt(sig)
+			n, err = decryptor.decryptN(ctx, client, cache, n)
 			if err != nil {
-				return extractor.Data{}, err
+				return "", err
 			}
-			resUrl = baseUrl + "&" + sigParam + "=" + sigDecrypted
+			params[i] = "n=" + url.QueryEscape(n)
 		}
-
-		return extractor.Data{
-			SourceUrl:   vUrl,
-			StreamUrl:   resUrl,
-			Title:       data.VideoDetails.Title,
-			Description: data.VideoDetails.ShortDescription,
-			Uploader:    data.VideoDetails.Author,
-			Duration:    duration,
-			Expires:     time.Now().Add(time.Duration(expires) * time.Second),
-		}, nil
 	}
+	return base + "?" + strings.Join(params, "&"), nil
+}
 
-	isOk := func(strmUrl string) bool {
-		resp, err := http.Get(strmUrl)
-		if err != nil {
-			return false
-		}
-		defer resp.Body.Close()
-		return resp.StatusCode == 200
+// Only requests the first byte, so as not to download the whole stream.
+func streamUrlWorks(ctx context.Context, client *http.Client, strmUrl string) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", strmUrl, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
 	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent
+}
 
-	// Sometimes we just get an invalid stream URL, and I didn't find anything
-	// simple to do about it, so we just try the stream URL we get and repeat
-	// if it's invalid
-	for tries := 0; tries < 10; tries++ {
-		data, err := try()
-		if err != nil {
-			return extractor.Data{}, err
-		}
-		if isOk(data.StreamUrl) {
-			return data, nil
+// Items of a playlist as the browse endpoint returns them; each page ends with
+// a continuation item if there's more.
+type playlistItem struct {
+	PlaylistVideoRenderer *struct {
+		VideoId string `json:"videoId"`
+		Title   struct {
+			Runs []struct {
+				Text string `json:"text"`
+			} `json:"runs"`
+		} `json:"title"`
+		ShortBylineText struct {
+			Runs []struct {
+				Text string `json:"text"` // uploader name
+			} `json:"runs"`
+		} `json:"shortBylineText"`
+		LengthSeconds string `json:"lengthSeconds"`
+		// Not set for deleted or private videos
+		IsPlayable bool `json:"isPlayable"`
+	} `json:"playlistVideoRenderer"`
+	ContinuationItemRenderer *struct {
+		ContinuationEndpoint struct {
+			ContinuationCommand struct {
+				Token string `json:"token"`
+			} `json:"continuationCommand"`
+		} `json:"continuationEndpoint"`
+	} `json:"continuationItemRenderer"`
+}
+
+type playlistBrowseData struct {
+	Metadata struct {
+		PlaylistMetadataRenderer struct {
+			Title string `json:"title"`
+		} `json:"playlistMetadataRenderer"`
+	} `json:"metadata"`
+	// First page
+	Contents struct {
+		TwoColumnBrowseResultsRenderer struct {
+			Tabs []struct {
+				TabRenderer struct {
+					Content struct {
+						SectionListRenderer struct {
+							Contents []struct {
+								ItemSectionRenderer struct {
+									Contents []struct {
+										PlaylistVideoListRenderer struct {
+											Contents []playlistItem `json:"contents"`
+										} `json:"playlistVideoListRenderer"`
+									} `json:"contents"`
+								} `json:"itemSectionRenderer"`
+							} `json:"contents"`
+						} `json:"sectionListRenderer"`
+					} `json:"content"`
+				} `json:"tabRenderer"`
+			} `json:"tabs"`
+		} `json:"twoColumnBrowseResultsRenderer"`
+	} `json:"contents"`
+	// All following pages
+	OnResponseReceivedActions []struct {
+		AppendContinuationItemsAction struct {
+			ContinuationItems []playlistItem `json:"continuationItems"`
+		} `json:"appendContinuationItemsAction"`
+	} `json:"onResponseReceivedActions"`
+}
+
+func (d *playlistBrowseData) items() []playlistItem {
+	var res []playlistItem
+	for _, tab := range d.Contents.TwoColumnBrowseResultsRenderer.Tabs {
+		for _, section := range tab.TabRenderer.Content.SectionListRenderer.Contents {
+			for _, v := range section.ItemSectionRenderer.Contents {
+				res = append(res, v.PlaylistVideoListRenderer.Contents...)
+			}
 		}
 	}
-
-	return extractor.Data{}, ErrDecryptFunctionBroken
+	for _, v := range d.OnResponseReceivedActions {
+		res = append(res, v.AppendContinuationItemsAction.ContinuationItems...)
+	}
+	return res
 }
 
-type playlistVideoData struct {
+type mixVideoData struct {
 	Contents struct {
 		TwoColumnWatchNextResults struct {
 			Playlist struct {
@@ -178,79 +402,279 @@ type playlistVideoData struct {
 	} `json:"contents"`
 }
 
-// Only gets superficial data, the actual stream URL must be extracted from SourceUrl
-func getPlaylist(pUrl string) ([]extractor.Data, error) {
+// Reports whether the URL is of an auto-generated mix (list=RD...), which are
+// endless.
+func isMix(pUrl string) bool {
 	u, err := url.Parse(pUrl)
 	if err != nil {
-		return nil, err
+		return false
+	}
+	return strings.HasPrefix(u.Query().Get("list"), "RD")
+}
+
+// Returned by page functions to stop getting further pages.
+var errPlaylistDone = errors.New("no more playlist pages needed")
+
+// Calls fn with each page of the playlist's videos as soon as it's loaded, at
+// most limit videos in total, unless limit is 0. Videos which can't be played
+// (e.g. deleted or private ones) are included, but marked as Unavailable. Only
+// gets superficial data, the actual stream URL must be extracted from
+// SourceUrl.
+func getPlaylistFunc(ctx context.Context, client *http.Client, pUrl string, limit int, fn func([]extractor.Data) error) error {
+	u, err := url.Parse(pUrl)
+	if err != nil {
+		return err
 	}
 	q, err := url.ParseQuery(u.RawQuery)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	listId := q.Get("list")
-	vidId := ""
-	index := 0
 
-	var res []extractor.Data
+	// Links to a video in a playlist (index is 1-based) start playing there;
+	// everything before it is held back until we get there. If we never do,
+	// the whole playlist is played after all.
+	skip := 0
+	startUrl := ""
+	if i, err := strconv.Atoi(q.Get("index")); err == nil && i >= 1 {
+		skip = i - 1
+	} else if v := q.Get("v"); v != "" {
+		startUrl = "https://www.youtube.com/watch?v=" + v
+	}
+	started := skip == 0 && startUrl == ""
+	var held []extractor.Data
+
+	n := 0
+	emit := func(data []extractor.Data) error {
+		if len(data) == 0 {
+			return nil
+		}
+		done := limit != 0 && n+len(data) >= limit
+		if done {
+			data = data[:limit-n]
+		}
+		n += len(data)
+		if err := fn(data); err != nil {
+			return err
+		}
+		if done {
+			return errPlaylistDone
+		}
+		return nil
+	}
+	page := func(data []extractor.Data) error {
+		if started {
+			return emit(data)
+		}
+		held = append(held, data...)
+		start := -1
+		if skip > 0 {
+			if skip < len(held) {
+				start = skip
+			}
+		} else {
+			for i := range held {
+				if held[i].SourceUrl == startUrl {
+					start = i
+					break
+				}
+			}
+		}
+		if start == -1 {
+			return nil
+		}
+		started = true
+		data = held[start:]
+		held = nil
+		data[0].StartOffset = exutil.StartOffset(u)
+		return emit(data)
+	}
 
-	// This loop uses the playlist sidebar: each video played in the context
-	// of a playlist loads 100 or so of the following videos' infos, which we
-	// add to the returned slice; then we take the last retrieved video's infos
-	// and use its sidebar and so on
+	if isMix(pUrl) {
+		err = getMixFunc(ctx, client, q.Get("list"), q.Get("v"), page)
+	} else {
+		err = browsePlaylistFunc(ctx, client, q.Get("list"), page)
+	}
+	if err == errPlaylistDone {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !started {
+		if err := emit(held); err != nil && err != errPlaylistDone {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follows the continuation tokens from page to page; each page has 100 videos
+// or so.
+func browsePlaylistFunc(ctx context.Context, client *http.Client, listId string, page func([]extractor.Data) error) error {
+	playlistUrl := "https://www.youtube.com/playlist?list=" + listId
+	var title string
+	body := map[string]any{
+		"browseId": "VL" + listId,
+	}
 	for {
-		vUrl := "https://www.youtube.com/watch?v=" + vidId + "&list=" + listId + "&index=" + strconv.Itoa(index+1)
+		var data playlistBrowseData
+		if err := innertubePost(ctx, client, baseUrl, webClient, "browse", body, &data); err != nil {
+			return err
+		}
+		if t := data.Metadata.PlaylistMetadataRenderer.Title; t != "" {
+			// Only the first page has it
+			title = t
+		}
 
-		// Get JSON string from YouTube
-		v, err := getJSVar(vUrl, "ytInitialData")
-		if err != nil {
-			return nil, err
+		var res []extractor.Data
+		continuation := ""
+		for _, item := range data.items() {
+			if c := item.ContinuationItemRenderer; c != nil {
+				continuation = c.ContinuationEndpoint.ContinuationCommand.Token
+				continue
+			}
+			v := item.PlaylistVideoRenderer
+			if v == nil {
+				continue
+			}
+
+			d := extractor.Data{
+				SourceUrl:     "https://www.youtube.com/watch?v=" + v.VideoId,
+				PlaylistUrl:   playlistUrl,
+				PlaylistTitle: title,
+				Thumbnail:     thumbnailUrl(v.VideoId),
+				Duration:      -1,
+			}
+			if len(v.Title.Runs) != 0 {
+				d.Title = v.Title.Runs[0].Text
+			}
+			if !v.IsPlayable {
+				d.Unavailable = true
+				res = append(res, d)
+				continue
+			}
+
+			if len(v.ShortBylineText.Runs) == 0 {
+				return ErrMalformedJson
+			}
+			d.Uploader = v.ShortBylineText.Runs[0].Text
+			d.Artist = topicArtist(d.Uploader)
+			if length, err := strconv.Atoi(v.LengthSeconds); err == nil {
+				d.Duration = length
+			}
+			res = append(res, d)
 		}
 
-		// Parse playlist data scraped from YouTube
-		var data playlistVideoData
-		if err := json.Unmarshal([]byte(v), &data); err != nil {
-			return nil, err
+		if err := page(res); err != nil {
+			return err
+		}
+		if continuation == "" {
+			return nil
+		}
+		body = map[string]any{
+			"continuation": continuation,
+		}
+	}
+}
+
+// Mixes have no playlist page, so this uses the watch page's sidebar instead:
+// each video played in the context of a mix loads some of the following
+// videos' infos; then we take the last retrieved video's infos and use its
+// sidebar and so on.
+func getMixFunc(ctx context.Context, client *http.Client, listId, vidId string, page func([]extractor.Data) error) error {
+	// Mixes are generated from a video, without which they don't exist
+	playlistUrl := "https://www.youtube.com/watch?v=" + vidId + "&list=" + listId
+	index := 0
+	next := 0
+	for {
+		body := map[string]any{
+			"playlistId":    listId,
+			"videoId":       vidId,
+			"playlistIndex": index,
+		}
+		var data mixVideoData
+		if err := innertubePost(ctx, client, baseUrl, webClient, "next", body, &data); err != nil {
+			return err
 		}
 
-		added := false
+		var res []extractor.Data
 		for _, v := range data.Contents.TwoColumnWatchNextResults.Playlist.Playlist.Contents {
 			vidId = v.PlaylistPanelVideoRenderer.NavigationEndpoint.WatchEndpoint.VideoId
 			index = v.PlaylistPanelVideoRenderer.NavigationEndpoint.WatchEndpoint.Index
+			if index != next {
+				// Already got it from the previous page
+				continue
+			}
+			next++
 
-			if index == len(res) {
-				srcUrl := "https://www.youtube.com/watch?v=" + vidId
-
-				bylineText := v.PlaylistPanelVideoRenderer.ShortBylineText
-				if len(bylineText.Runs) == 0 {
-					return nil, ErrMalformedJson
-				}
-				uploader := bylineText.Runs[0].Text
+			bylineText := v.PlaylistPanelVideoRenderer.ShortBylineText
+			if len(bylineText.Runs) == 0 {
+				return ErrMalformedJson
+			}
+			length, err := util.ParseDurationSeconds(v.PlaylistPanelVideoRenderer.LengthText.SimpleText)
+			if err != nil {
+				length = -1
+			}
+			res = append(res, extractor.Data{
+				SourceUrl:     "https://www.youtube.com/watch?v=" + vidId,
+				Title:         v.PlaylistPanelVideoRenderer.Title.SimpleText,
+				PlaylistUrl:   playlistUrl,
+				PlaylistTitle: data.Contents.TwoColumnWatchNextResults.Playlist.Playlist.Title,
+				Uploader:      bylineText.Runs[0].Text,
+				Artist:        topicArtist(bylineText.Runs[0].Text),
+				Thumbnail:     thumbnailUrl(vidId),
+				Duration:      length,
+			})
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		if err := page(res); err != nil {
+			return err
+		}
+	}
+}
 
-				length, err := util.ParseDurationSeconds(v.PlaylistPanelVideoRenderer.LengthText.SimpleText)
-				if err != nil {
-					length = -1
-				}
+type channelData struct {
+	Metadata struct {
+		ChannelMetadataRenderer struct {
+			ExternalId string `json:"externalId"` // channel ID
+		} `json:"channelMetadataRenderer"`
+	} `json:"metadata"`
+}
 
-				res = append(res, extractor.Data{
-					SourceUrl:     srcUrl,
-					Title:         v.PlaylistPanelVideoRenderer.Title.SimpleText,
-					PlaylistUrl:   "https://www.youtube.com/playlist?list=" + listId,
-					PlaylistTitle: data.Contents.TwoColumnWatchNextResults.Playlist.Playlist.Title,
-					Uploader:      uploader,
-					Duration:      length,
-				})
+// Calls fn with the channel's most recent uploads (at most limit, unless limit
+// is 0), page by page. Only gets superficial data, the actual stream URL must
+// be extracted from SourceUrl.
+func getChannelFunc(ctx context.Context, client *http.Client, cUrl string, limit int, fn func([]extractor.Data) error) error {
+	u, err := url.Parse(cUrl)
+	if err != nil {
+		return err
+	}
 
-				added = true
-			}
+	var channelId string
+	sp := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if sp[0] == "channel" {
+		channelId = sp[1]
+	} else {
+		// Handles (/@...) have to be looked up
+		v, err := getJSVar(ctx, client, "https://www.youtube.com/"+sp[0], "ytInitialData")
+		if err != nil {
+			return err
 		}
-
-		if !added {
-			break
+		var data channelData
+		if err := json.Unmarshal([]byte(v), &data); err != nil {
+			return err
 		}
+		channelId = data.Metadata.ChannelMetadataRenderer.ExternalId
+	}
+	if !strings.HasPrefix(channelId, "UC") {
+		return ErrChannelNotFound
 	}
 
-	return res, nil
+	// Each channel has a playlist of all its uploads, newest first, whose ID
+	// is the channel ID starting with UU instead of UC
+	return getPlaylistFunc(ctx, client, "https://www.youtube.com/playlist?list=UU"+channelId[2:], limit, fn)
 }
 
 type searchData struct {
@@ -298,18 +722,9 @@ type searchData struct {
 }
 
 // Only gets superficial data, the actual stream URL must be extracted from SourceUrl
-func getSearch(query string) ([]extractor.Data, error) {
-	// Get JSON string from YouTube
-	sanitizedQuery := url.QueryEscape(strings.ReplaceAll(query, " ", "+"))
-	queryUrl := "https://www.youtube.com/results?search_query=" + sanitizedQuery
-	v, err := getJSVar(queryUrl, "ytInitialData")
-	if err != nil {
-		return nil, err
-	}
-
-	// Parse search data scraped from YouTube
+func getSearch(ctx context.Context, client *http.Client, query string) ([]extractor.Data, error) {
 	var data searchData
-	if err := json.Unmarshal([]byte(v), &data); err != nil {
+	if err := innertubePost(ctx, client, baseUrl, webClient, "search", map[string]any{"query": query}, &data); err != nil {
 		return nil, err
 	}
 
@@ -341,12 +756,16 @@ func getSearch(query string) ([]extractor.Data, error) {
 					Title:          title,
 					Duration:       length,
 					Uploader:       uploader,
+					Artist:         topicArtist(uploader),
+					Thumbnail:      thumbnailUrl(v1.VideoRenderer.VideoId),
 					OfficialArtist: len(badges) != 0 && badges[0].MetadataBadgeRenderer.Style == "BADGE_STYLE_TYPE_VERIFIED_ARTIST",
+					Source:         "YouTube",
 				})
 			} else if v1.PlaylistRenderer.PlaylistId != "" {
 				res = append(res, extractor.Data{
 					PlaylistUrl:   "https://www.youtube.com/playlist?list=" + v1.PlaylistRenderer.PlaylistId,
 					PlaylistTitle: v1.PlaylistRenderer.Title.SimpleText,
+					Source:        "YouTube",
 				})
 			}
 		}
@@ -355,9 +774,9 @@ func getSearch(query string) ([]extractor.Data, error) {
 	return res, nil
 }
 
-func getSearchSuggestions(query string) ([]string, error) {
+func getSearchSuggestions(ctx context.Context, client *http.Client, query string) ([]string, error) {
 	url := "https://suggestqueries-clients6.youtube.com/complete/search?client=youtube&ds=yt&q=" + url.QueryEscape(query)
-	resp, err := http.Get(url)
+	resp, err := exutil.HttpGet(ctx, client, url)
 	if err != nil {
 		return nil, err
 	}
@@ -398,11 +817,11 @@ func getSearchSuggestions(query string) ([]string, error) {
 
 // Gets a constant JavaScript variable's value from a URL and a variable name
 // (variable format must be: var someVarName = {"somekey": "lol"};)
-func getJSVar(url, varName string) (string, error) {
+func getJSVar(ctx context.Context, client *http.Client, url, varName string) (string, error) {
 	match := "var " + varName + " = "
 
 	var res string
-	err := exutil.GetHTMLScriptFunc(url, true, func(code string) bool {
+	err := exutil.GetHTMLScriptFunc(ctx, client, url, true, func(code string) bool {
 		if strings.HasPrefix(code, match) {
 			res = strings.TrimRight(code[len(match):], ";")
 			return false
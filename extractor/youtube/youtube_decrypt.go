@@ -1,60 +1,165 @@
 package youtube
 
 import (
+	"git.nobrain.org/r4/dischord/extractor"
 	exutil "git.nobrain.org/r4/dischord/extractor/util"
 
+	"github.com/dop251/goja"
+
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	ErrDecryptGettingFunctionName = errors.New("error getting signature decryption function name")
 	ErrDecryptGettingFunction     = errors.New("error getting signature decryption function")
 	ErrDecryptGettingOpTable      = errors.New("error getting signature decryption operation table")
+	ErrDecryptEvaluating          = errors.New("error evaluating decryption function")
 	ErrGettingBaseJs              = errors.New("unable to get base.js")
 )
 
-type decryptorOp struct {
-	fn  func(a *string, b int)
-	arg int
-}
+const (
+	// How long to go without looking for a new base.js version
+	decryptorCheckInterval = time.Hour
+	// The functions cut out of base.js finish almost instantly; if they
+	// don't, they're most likely stuck in a loop
+	maxJsDuration = 5 * time.Second
+)
 
 type decryptor struct {
+	// Guards everything below; the JS runtime isn't safe for concurrent use
+	mu sync.Mutex
 	// base.js version ID, used for caching
 	versionId string
-	// The actual decryption algorithm can be split up into a list of known
-	// operations
-	ops []decryptorOp
+	// When the version was last looked up
+	checked time.Time
+	// Runtime holding the functions cut out of base.js
+	vm *goja.Runtime
+	// Decrypts the "s" part of a signature cipher
+	sigFn goja.Callable
+	// Transforms the "n" URL parameter; without it, YouTube throttles the
+	// stream. nil if base.js doesn't seem to have one.
+	nFn goja.Callable
+	// Identifies the decryption algorithm to the InnerTube API, so that it
+	// gives us signatures we can decrypt; 0 if unknown
+	signatureTimestamp int
+}
+
+func (d *decryptor) decrypt(ctx context.Context, client *http.Client, cache extractor.Cache, input string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := updateDecryptor(ctx, client, cache, d); err != nil {
+		return "", err
+	}
+	return d.call(ctx, d.sigFn, input)
+}
+
+// Returns the input unchanged if base.js has no n function.
+func (d *decryptor) decryptN(ctx context.Context, client *http.Client, cache extractor.Cache, input string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := updateDecryptor(ctx, client, cache, d); err != nil {
+		return "", err
+	}
+	if d.nFn == nil {
+		return input, nil
+	}
+	res, err := d.call(ctx, d.nFn, input)
+	if err != nil {
+		return "", err
+	}
+	// That's what the n function returns when it throws internally
+	if strings.HasPrefix(res, "enhanced_except_") {
+		return "", ErrDecryptEvaluating
+	}
+	return res, nil
 }
 
-func (d *decryptor) decrypt(input string) (string, error) {
-	if err := updateDecryptor(d); err != nil {
+func (d *decryptor) call(ctx context.Context, fn goja.Callable, input string) (string, error) {
+	var res goja.Value
+	err := runJs(ctx, d.vm, func() (err error) {
+		res, err = fn(goja.Undefined(), d.vm.ToValue(input))
+		return err
+	})
+	if err != nil {
 		return "", err
 	}
+	return res.String(), nil
+}
+
+// Runs f, which runs JavaScript in vm, and interrupts it once ctx is done or
+// it takes longer than maxJsDuration. base.js isn't ours, so it could loop
+// forever.
+func runJs(ctx context.Context, vm *goja.Runtime, f func() error) error {
+	jsCtx, cancel := context.WithTimeout(ctx, maxJsDuration)
+	defer cancel()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-jsCtx.Done():
+			vm.Interrupt(jsCtx.Err())
+		case <-done:
+		}
+	}()
+	err := f()
+	close(done)
+	wg.Wait()
+	vm.ClearInterrupt()
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%w: %v", ErrDecryptEvaluating, err)
+	}
+	return nil
+}
 
-	s := input
-	for _, op := range d.ops {
-		op.fn(&s, op.arg)
+func (d *decryptor) getSignatureTimestamp(ctx context.Context, client *http.Client, cache extractor.Cache) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := updateDecryptor(ctx, client, cache, d); err != nil {
+		return 0, err
 	}
-	return s, nil
+	return d.signatureTimestamp, nil
+}
+
+// Makes the next call look for a new base.js version right away, e.g. because
+// the current one stopped working.
+func (d *decryptor) expire() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.checked = time.Time{}
 }
 
 type configData struct {
 	PlayerJsUrl string `json:"PLAYER_JS_URL"`
 }
 
-func updateDecryptor(d *decryptor) error {
+// d.mu must be held by the caller.
+func updateDecryptor(ctx context.Context, client *http.Client, cache extractor.Cache, d *decryptor) error {
+	if d.vm != nil && time.Since(d.checked) < decryptorCheckInterval {
+		return nil
+	}
+
 	prefix := "(function() {window.ytplayer={};\nytcfg.set("
 	endStr := ");"
 	// Get base.js URL
 	var url string
 	var funcErr error
-	err := exutil.GetHTMLScriptFunc("https://www.youtube.com", false, func(code string) bool {
+	err := exutil.GetHTMLScriptFunc(ctx, client, "https://www.youtube.com", false, func(code string) bool {
 		if strings.HasPrefix(code, prefix) {
 			// Cut out the JSON part
 			code = code[len(prefix):]
@@ -80,11 +185,11 @@ func updateDecryptor(d *decryptor) error {
 		return err
 	}
 	if funcErr != nil {
-		return err
+		return funcErr
 	}
 
 	// Get base.js version ID
-	sp := strings.SplitN(strings.TrimPrefix(url, "/s/player/"), "/", 2)
+	sp := strings.SplitN(strings.TrimPrefix(url, "https://www.youtube.com/s/player/"), "/", 2)
 	if len(sp) != 2 {
 		return ErrGettingBaseJs
 	}
@@ -92,154 +197,258 @@ func updateDecryptor(d *decryptor) error {
 
 	if d.versionId == verId {
 		// Decryptor already up-to-date
+		d.checked = time.Now()
 		return nil
 	}
 
-	// Get base.js contents
-	resp, err := http.Get(url)
+	// base.js is a couple of megabytes and only changes with the version, so
+	// it's worth keeping around
+	cacheKey := "youtube-base-js"
+	var baseJs string
+	if data, ok := cache.Get(cacheKey); ok {
+		if cachedVerId, js, ok := strings.Cut(string(data), "\n"); ok && cachedVerId == verId {
+			baseJs = js
+		}
+	}
+	if baseJs == "" {
+		js, err := getBaseJs(ctx, client, url)
+		if err != nil {
+			return err
+		}
+		baseJs = js
+		cache.Set(cacheKey, []byte(verId+"\n"+baseJs), time.Now().Add(30*24*time.Hour))
+	}
+
+	// Cut out the functions we need and load them into a fresh runtime
+	code, err := getDecryptCode(baseJs)
+	if err != nil {
+		return err
+	}
+	vm := goja.New()
+	err = runJs(ctx, vm, func() error {
+		_, err := vm.RunString(code)
+		return err
+	})
 	if err != nil {
 		return err
 	}
+	sigFn, ok := goja.AssertFunction(vm.Get("decryptSig"))
+	if !ok {
+		return ErrDecryptEvaluating
+	}
+	nFn, _ := goja.AssertFunction(vm.Get("decryptN"))
+
+	d.versionId = verId
+	d.checked = time.Now()
+	d.vm = vm
+	d.sigFn = sigFn
+	d.nFn = nFn
+	d.signatureTimestamp = 0
+	if m := signatureTimestampRegexp.FindStringSubmatch(baseJs); m != nil {
+		d.signatureTimestamp, _ = strconv.Atoi(m[1])
+	}
+	return nil
+}
+
+func getBaseJs(ctx context.Context, client *http.Client, url string) (string, error) {
+	resp, err := exutil.HttpGet(ctx, client, url)
+	if err != nil {
+		return "", err
+	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return ErrGettingBaseJs
+		return "", ErrGettingBaseJs
 	}
 
 	// Copy contents to buffer
 	buf := new(strings.Builder)
 	_, err = io.Copy(buf, resp.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
+	return buf.String(), nil
+}
 
-	// Get decryption operations
-	ops, err := getDecryptOps(buf.String())
-	if err != nil {
-		return err
-	}
+var signatureTimestampRegexp = regexp.MustCompile(`(?:signatureTimestamp|sts):(\d+)`)
 
-	d.versionId = verId
-	d.ops = ops
-	return nil
+// The different ways base.js has been seen calling the signature decryption
+// function; the first submatch is always the function name
+var decryptFunctionNameRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`\b[a-zA-Z0-9$]+&&\([a-zA-Z0-9$]+=([a-zA-Z0-9$]{2,})\(decodeURIComponent\([a-zA-Z0-9$]+\)\)`),
+	regexp.MustCompile(`\b([a-zA-Z0-9$]{2,})\s*=\s*function\(\s*a\s*\)\s*\{\s*a\s*=\s*a\.split\(\s*""\s*\)`),
+	regexp.MustCompile(`\.sig\|\|([a-zA-Z0-9$]+)\(`),
 }
 
-var decryptFunctionNameRegexp = regexp.MustCompile(`[a-zA-Z]*&&\([a-zA-Z]*=([a-zA-Z]*)\(decodeURIComponent\([a-zA-Z]*\)\),[a-zA-Z]*\.set\([a-zA-Z]*,encodeURIComponent\([a-zA-Z]*\)\)\)`)
+// The n function is sometimes called directly and sometimes through an array
+// holding it, in which case the second submatch is the index
+var nFunctionNameRegexp = regexp.MustCompile(`\.get\("n"\)\)&&\([a-zA-Z0-9$]+=([a-zA-Z0-9$]+)(?:\[(\d+)\])?\([a-zA-Z0-9$]+\)`)
 
-func getDecryptFunction(baseJs string) (string, error) {
-	idx := decryptFunctionNameRegexp.FindSubmatchIndex([]byte(baseJs))
-	if len(idx) != 4 {
+// The signature decryption function calls the operations on a helper object
+var decryptOpTableRegexp = regexp.MustCompile(`;([a-zA-Z0-9$]{2,})\.[a-zA-Z0-9$]{2,}\(`)
+
+// The n function bails out early when a global from the rest of base.js is
+// missing, which it always is for us
+var nFunctionEarlyReturnRegexp = regexp.MustCompile(`;\s*if\s*\(\s*typeof\s+[a-zA-Z0-9_$]+\s*===?\s*(?:"undefined"|'undefined'|[a-zA-Z0-9_$]+\[\d+\])\s*\)\s*return\s+[a-zA-Z0-9_$]+;`)
+
+// Returns self-contained JS defining decryptSig and, if base.js has an n
+// function, decryptN.
+func getDecryptCode(baseJs string) (string, error) {
+	var sigName string
+	for _, re := range decryptFunctionNameRegexps {
+		if m := re.FindStringSubmatch(baseJs); m != nil {
+			sigName = m[1]
+			break
+		}
+	}
+	if sigName == "" {
 		return "", ErrDecryptGettingFunctionName
 	}
-	fnName := baseJs[idx[2]:idx[3]]
-
-	startMatch := fnName + `=function(a){a=a.split("");`
-	endMatch := `;return a.join("")};`
-	start := strings.Index(baseJs, startMatch)
-	if start == -1 {
+	sigFn, ok := jsFunction(baseJs, sigName)
+	if !ok {
 		return "", ErrDecryptGettingFunction
 	}
-	fn := baseJs[start+len(startMatch):]
-	end := strings.Index(fn, endMatch)
-	if end == -1 {
-		return "", ErrDecryptGettingFunction
+
+	code := new(strings.Builder)
+	m := decryptOpTableRegexp.FindStringSubmatch(sigFn)
+	if m == nil {
+		return "", ErrDecryptGettingOpTable
+	}
+	opTable, ok := jsObject(baseJs, m[1])
+	if !ok {
+		return "", ErrDecryptGettingOpTable
+	}
+	fmt.Fprintf(code, "var %v=%v;\n", m[1], opTable)
+	fmt.Fprintf(code, "var decryptSig=%v;\n", sigFn)
+
+	// Not having an n function isn't fatal; the stream is just slower
+	if nName := getNFunctionName(baseJs); nName != "" {
+		if nFn, ok := jsFunction(baseJs, nName); ok {
+			nFn = nFunctionEarlyReturnRegexp.ReplaceAllString(nFn, ";")
+			fmt.Fprintf(code, "var decryptN=%v;\n", nFn)
+		}
 	}
-	return fn[:end], nil
+	return code.String(), nil
 }
 
-func getDecryptOps(baseJs string) ([]decryptorOp, error) {
-	// Extract main decryptor function JS
-	decrFn, err := getDecryptFunction(baseJs)
-	if err != nil {
-		return nil, err
+func getNFunctionName(baseJs string) string {
+	m := nFunctionNameRegexp.FindStringSubmatch(baseJs)
+	if m == nil {
+		return ""
 	}
+	if m[2] == "" {
+		return m[1]
+	}
+	// Look the name up in the array
+	idx, _ := strconv.Atoi(m[2])
+	arr := regexp.MustCompile(`var ` + regexp.QuoteMeta(m[1]) + `\s*=\s*\[([a-zA-Z0-9$,\s]*)\]`).FindStringSubmatch(baseJs)
+	if arr == nil {
+		return ""
+	}
+	names := strings.Split(arr[1], ",")
+	if idx >= len(names) {
+		return ""
+	}
+	return strings.TrimSpace(names[idx])
+}
 
-	// Get decyptor operation JS
-	var ops string
-	{
-		sp := strings.SplitN(decrFn, ".", 2)
-		if len(sp) != 2 {
-			return nil, ErrDecryptGettingOpTable
-		}
-		opsObjName := sp[0]
+// Returns the source of a function defined as either `name=function(...){...}`
+// or `function name(...){...}`, as an expression.
+func jsFunction(js string, name string) (string, bool) {
+	re := regexp.MustCompile(`(?:^|[^a-zA-Z0-9$.])(?:` + regexp.QuoteMeta(name) + `\s*=\s*function|function\s+` + regexp.QuoteMeta(name) + `)\s*\(`)
+	loc := re.FindStringIndex(js)
+	if loc == nil {
+		return "", false
+	}
+	params := js[loc[1]-1:]
+	brace := strings.Index(params, "{")
+	if brace == -1 {
+		return "", false
+	}
+	end := jsBlockEnd(params[brace:])
+	if end == -1 {
+		return "", false
+	}
+	return "function" + params[:brace+end], true
+}
 
-		startMatch := `var ` + opsObjName + `={`
-		endMatch := `};`
-		start := strings.Index(baseJs, startMatch)
-		if start == -1 {
-			return nil, ErrDecryptGettingOpTable
-		}
-		ops = baseJs[start+len(startMatch):]
-		end := strings.Index(ops, endMatch)
-		if end == -1 {
-			return nil, ErrDecryptGettingOpTable
-		}
-		ops = ops[:end]
+// Returns the source of an object literal defined as `var name={...}`.
+func jsObject(js string, name string) (string, bool) {
+	re := regexp.MustCompile(`var\s+` + regexp.QuoteMeta(name) + `\s*=\s*\{`)
+	loc := re.FindStringIndex(js)
+	if loc == nil {
+		return "", false
 	}
+	obj := js[loc[1]-1:]
+	end := jsBlockEnd(obj)
+	if end == -1 {
+		return "", false
+	}
+	return obj[:end], true
+}
 
-	// Make a decryptor operation table that associates the operation
-	// names with a specific action on an input string
-	opTable := make(map[string]func(a *string, b int))
-	{
-		lns := strings.Split(ops, "\n")
-		if len(lns) != 3 {
-			return nil, ErrDecryptGettingOpTable
-		}
-		for _, ln := range lns {
-			sp := strings.Split(ln, ":")
-			if len(sp) != 2 {
-				return nil, ErrDecryptGettingOpTable
+// Returns the index just past the brace closing the one s starts with, or -1.
+// Braces inside of strings and regular expressions are skipped over.
+func jsBlockEnd(s string) int {
+	depth := 0
+	// Last character that wasn't whitespace; tells regexps apart from
+	// divisions
+	var last byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i + 1
 			}
-			name := sp[0]
-			fn := sp[1]
-			switch {
-			case strings.HasPrefix(fn, `function(a){a.reverse()}`):
-				opTable[name] = func(a *string, b int) {
-					// Reverse a
-					var res string
-					for _, c := range *a {
-						res = string(c) + res
-					}
-					*a = res
+		case '"', '\'', '`':
+			i = jsLiteralEnd(s, i, c)
+		case '/':
+			if i+1 < len(s) && s[i+1] == '/' {
+				// Line comment
+				if end := strings.IndexByte(s[i:], '\n'); end != -1 {
+					i += end
+				} else {
+					return -1
 				}
-			case strings.HasPrefix(fn, `function(a,b){var c=a[0];a[0]=a[b%a.length];a[b%a.length]=c}`):
-				opTable[name] = func(a *string, b int) {
-					// Swap a[0] and a[b % len(a)]
-					c := []byte(*a)
-					c[0], c[b%len(*a)] = c[b%len(*a)], c[0]
-					*a = string(c)
-				}
-			case strings.HasPrefix(fn, `function(a,b){a.splice(0,b)}`):
-				opTable[name] = func(a *string, b int) {
-					// Slice off all elements of a up to a[b]
-					*a = (*a)[b:]
+			} else if i+1 < len(s) && s[i+1] == '*' {
+				// Block comment
+				if end := strings.Index(s[i+2:], "*/"); end != -1 {
+					i += end + 3
+				} else {
+					return -1
 				}
+			} else if last == 0 || strings.IndexByte("(,=:[!&|?{};+-*%<>~^", last) != -1 {
+				i = jsLiteralEnd(s, i, '/')
 			}
 		}
-	}
-
-	// Parse all operations in the main decryptor function and return them in
-	// order
-	var res []decryptorOp
-	for _, fn := range strings.Split(decrFn, ";") {
-		sp := strings.SplitN(fn, ".", 2)
-		if len(sp) != 2 {
-			return nil, ErrDecryptGettingOpTable
-		}
-		sp = strings.SplitN(sp[1], "(", 2)
-		if len(sp) != 2 {
-			return nil, ErrDecryptGettingOpTable
+		if i >= len(s) {
+			return -1
 		}
-		name := sp[0]
-		argS := strings.TrimSuffix(strings.TrimPrefix(sp[1], "a,"), ")")
-		arg, err := strconv.Atoi(argS)
-		if err != nil {
-			return nil, ErrDecryptGettingOpTable
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			last = s[i]
 		}
-		callableOp, exists := opTable[name]
-		if !exists {
-			return nil, ErrDecryptGettingOpTable
+	}
+	return -1
+}
+
+// Returns the index of the character closing the string or regexp literal
+// starting at s[start].
+func jsLiteralEnd(s string, start int, delim byte) int {
+	inClass := false // in a regexp character class like [/]
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\':
+			i++
+		case delim == '/' && c == '[':
+			inClass = true
+		case delim == '/' && c == ']':
+			inClass = false
+		case c == delim && !inClass:
+			return i
 		}
-		res = append(res, decryptorOp{callableOp, arg})
 	}
-	return res, nil
+	return len(s)
 }
@@ -0,0 +1,43 @@
+package youtube
+
+import (
+	"github.com/dop251/goja"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestRunJsInterrupt(t *testing.T) {
+	vm := goja.New()
+	loop := func() error {
+		_, err := vm.RunString("for (;;) {}")
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := runJs(ctx, vm, loop); err != context.DeadlineExceeded {
+		t.Errorf("Expected error '%v' but got '%v'", context.DeadlineExceeded, err)
+	}
+
+	// The runtime is usable again afterwards
+	err := runJs(context.Background(), vm, func() error {
+		_, err := vm.RunString("1 + 1")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Error: %v", err)
+	}
+
+	// Errors thrown by the code itself
+	err = runJs(context.Background(), vm, func() error {
+		_, err := vm.RunString("throw new Error('fixture')")
+		return err
+	})
+	if !errors.Is(err, ErrDecryptEvaluating) {
+		t.Errorf("Expected error '%v' but got '%v'", ErrDecryptEvaluating, err)
+	}
+}
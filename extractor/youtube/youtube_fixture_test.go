@@ -0,0 +1,245 @@
+package youtube_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/youtube"
+
+	"context"
+	"errors"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureYoutubeVideo(t *testing.T) {
+	cfg := fixture.Config(t)
+	for _, test := range []struct {
+		input     string
+		sourceUrl string
+	}{
+		{"https://www.youtube.com/watch?v=fixtureVid1", "https://www.youtube.com/watch?v=fixtureVid1"},
+		{"https://youtu.be/fixtureVid1", "https://youtu.be/fixtureVid1"},
+		{"https://www.youtube.com/shorts/fixtureVid1", "https://www.youtube.com/watch?v=fixtureVid1"},
+		{"https://youtube.com/live/fixtureVid1", "https://www.youtube.com/watch?v=fixtureVid1"},
+	} {
+		data, err := extractor.Extract(context.Background(), cfg, test.input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", test.input, err)
+		}
+		if len(data) == 1 {
+			fixture.CheckExpires(t, &data[0], 21540*time.Second)
+		}
+		fixture.CheckData(t, data, []extractor.Data{{
+			SourceUrl:   test.sourceUrl,
+			StreamUrl:   "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-video&itag=251",
+			Title:       "Fixture Video",
+			Description: "A video used for testing.\nSecond line.",
+			Uploader:    "Fixture Channel",
+			Year:        2010,
+			Thumbnail:   fixture.YoutubeThumbnail("fixtureVid1"),
+			Views:       1234567,
+			Duration:    212,
+		}})
+	}
+}
+
+func TestFixtureYoutubeSignatureCipher(t *testing.T) {
+	// Only the web client gets to play this video
+	data, err := extractor.Extract(context.Background(), fixture.Config(t), "https://www.youtube.com/watch?v=fixtureMus1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 1 {
+		t.Fatalf("Expected exactly one result but got %v", len(data))
+	}
+	// base.js reverses the signature, swaps the first and fourth character
+	// and cuts off the first one. It also shifts every character of n by one
+	// and reverses it.
+	expected := "https://rr1---sn-fixture.googlevideo.com/videoplayback?expire=1700000000&id=o-music&n=edcb&itag=251&sig=IHJFEDCBA"
+	if data[0].StreamUrl != expected {
+		t.Fatalf("Invalid stream URL: expected '%v' but got '%v'", expected, data[0].StreamUrl)
+	}
+}
+
+func TestFixtureYoutubeErrors(t *testing.T) {
+	for _, test := range []struct {
+		input   string
+		clients string // InnerTube clients; default if empty
+		err     error
+	}{
+		{"https://www.youtube.com/watch?v=fixtureSil1", "", youtube.ErrNoSuitableFormat},
+		{"https://www.youtube.com/watch?v=fixtureBrk1", "", youtube.ErrStreamUrlRejected},
+		{"https://www.youtube.com/watch?v=fixtureBrk2", "web", youtube.ErrDecryptFunctionBroken},
+		{"https://www.youtube.com/watch?v=fixtureGone", "", youtube.ErrVideoUnavailable},
+		{"https://www.youtube.com/watch?v=fixturePriv", "", youtube.ErrVideoPrivate},
+		{"https://www.youtube.com/watch?v=fixtureAge1", "", youtube.ErrAgeRestricted},
+		{"https://www.youtube.com/watch?v=fixtureAge1", "", extractor.ErrUnavailable},
+		{"https://www.youtube.com/watch?v=fixtureVid1", "android,nokia", youtube.ErrUnknownInnertubeClient},
+		{"https://www.youtube.com/playlist?list=PLbroken", "", youtube.ErrMalformedJson},
+	} {
+		cfg := fixture.Config(t)
+		cfg["youtube-dl"]["enabled"] = false // would be used as a fallback
+		if test.clients != "" {
+			cfg["youtube"]["innertube-clients"] = test.clients
+		}
+		_, err := extractor.Extract(context.Background(), cfg, test.input)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: expected error '%v' but got '%v'", test.input, test.err, err)
+		}
+	}
+}
+
+func TestFixtureYoutubeChannel(t *testing.T) {
+	cfg := fixture.Config(t)
+	cfg["youtube-dl"]["enabled"] = false
+	uploads := fixture.Playlist{Url: "https://www.youtube.com/playlist?list=UUfixture", Title: "Uploads from Fixture Channel"}
+	expected := []extractor.Data{
+		uploads.YoutubeVideo("fixtureUp00", "Newest Upload", "Fixture Channel", 180),
+		uploads.YoutubeVideo("fixtureUp01", "Older Upload", "Fixture Channel", 240),
+		uploads.YoutubeVideo("fixtureUp02", "Oldest Upload", "Fixture Channel", 300),
+	}
+
+	for _, input := range []string{
+		"https://www.youtube.com/channel/UCfixture",
+		"https://www.youtube.com/channel/UCfixture/videos",
+		"https://www.youtube.com/@fixture",
+		"https://youtube.com/@fixture/videos",
+	} {
+		data, err := extractor.Extract(context.Background(), cfg, input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		fixture.CheckData(t, data, expected)
+	}
+
+	cfg["youtube"]["max-channel-videos"] = int64(2)
+	data, err := extractor.Extract(context.Background(), cfg, "https://www.youtube.com/@fixture")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, expected[:2])
+
+	_, err = extractor.Extract(context.Background(), cfg, "https://www.youtube.com/@missing")
+	if !errors.Is(err, youtube.ErrChannelNotFound) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrChannelNotFound, err)
+	}
+}
+
+func TestFixtureYoutubeMix(t *testing.T) {
+	mix := fixture.Playlist{Url: "https://www.youtube.com/watch?v=fixtureVid1&list=RDfixtureVid1", Title: "Mix - Fixture Video"}
+
+	// The fixture's mix goes on longer than this, like real ones do
+	cfg := fixture.Config(t)
+	cfg["youtube"]["max-mix-videos"] = int64(5)
+	data, err := extractor.Extract(context.Background(), cfg, mix.Url)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, []extractor.Data{
+		mix.YoutubeVideo("fixtureVid1", "Fixture Video", "Fixture Channel", 212),
+		mix.YoutubeVideo("fixtureMx01", "Mix Video 1", "Other Channel", 181),
+		mix.YoutubeVideo("fixtureMx02", "Mix Video 2", "Other Channel", 182),
+		mix.YoutubeVideo("fixtureMx03", "Mix Video 3", "Other Channel", 183),
+		mix.YoutubeVideo("fixtureMx04", "Mix Video 4", "Other Channel", 184),
+	})
+}
+
+func TestFixtureYoutubeMusic(t *testing.T) {
+	cfg := fixture.Config(t)
+	cfg["youtube-dl"]["enabled"] = false
+
+	// Songs are played from regular YouTube
+	data, err := extractor.Extract(context.Background(), cfg, "https://music.youtube.com/watch?v=fixtureVid1")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 1 || data[0].SourceUrl != "https://www.youtube.com/watch?v=fixtureVid1" || data[0].Title != "Fixture Video" {
+		t.Fatalf("Expected the regular YouTube video but got %+v", data)
+	}
+
+	_, err = extractor.Extract(context.Background(), cfg, "https://music.youtube.com/browse/MPREb_missing")
+	if !errors.Is(err, youtube.ErrMusicAlbumNotFound) {
+		t.Fatalf("Expected error '%v' but got '%v'", youtube.ErrMusicAlbumNotFound, err)
+	}
+
+	// Artist pages etc. aren't supported
+	e := &youtube.Extractor{}
+	if e.Matches(e.DefaultConfig(), "https://music.youtube.com/browse/UCfixture") {
+		t.Fatalf("Artist page shouldn't match")
+	}
+}
+
+func TestFixtureYoutubePlaylist(t *testing.T) {
+	pls := fixture.Playlist{Url: "https://www.youtube.com/playlist?list=PLfixture", Title: "Fixture Playlist"}
+	unavailable := func(id, title string) extractor.Data {
+		d := pls.YoutubeVideo(id, title, "", -1)
+		d.Unavailable = true
+		return d
+	}
+	// Spread over two pages, the second of which is requested with the
+	// continuation token from the first one
+	expected := []extractor.Data{
+		pls.YoutubeVideo("fixturePl00", "Why I use Linux", "Fixture Channel", 70),
+		pls.YoutubeVideo("fixturePl01", "Second Video", "Fixture Channel", 754),
+		unavailable("fixtureDel1", "[Deleted video]"),
+		pls.YoutubeVideo("fixturePl02", "Third Video", "Other Channel", 3723),
+		pls.YoutubeVideo("fixturePl03", "Fourth Video", "Fixture Channel", -1),
+		unavailable("fixturePrv1", "[Private video]"),
+		pls.YoutubeVideo("fixturePl04", "Fifth Video", "Fixture Channel", 45),
+	}
+
+	cfg := fixture.Config(t)
+	for _, input := range []string{
+		pls.Url,
+		"https://music.youtube.com/playlist?list=PLfixture",
+		"https://music.youtube.com/browse/VLPLfixture",
+		// Albums are resolved to their playlist
+		"https://music.youtube.com/browse/MPREb_fixture",
+	} {
+		data, err := extractor.Extract(context.Background(), cfg, input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		fixture.CheckData(t, data, expected)
+	}
+
+	vUrl := "https://www.youtube.com/watch?v=fixtureVid1&list=PLfixture"
+	data, err := extractor.Extract(context.Background(), cfg, vUrl)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, expected)
+
+	// Links to a video in the playlist start there; the index includes
+	// unavailable videos
+	for _, input := range []string{
+		"https://www.youtube.com/watch?v=fixturePl03&list=PLfixture&index=5&t=42",
+		"https://www.youtube.com/watch?v=fixturePl03&list=PLfixture&t=42",
+	} {
+		data, err = extractor.Extract(context.Background(), cfg, input)
+		if err != nil {
+			t.Fatalf("%v: Error: %v", input, err)
+		}
+		start := append([]extractor.Data{}, expected[4:]...)
+		start[0].StartOffset = 42
+		fixture.CheckData(t, data, start)
+	}
+
+	// Past the end of the playlist
+	data, err = extractor.Extract(context.Background(), cfg, "https://www.youtube.com/watch?v=fixturePl03&list=PLfixture&index=50")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	fixture.CheckData(t, data, expected)
+
+	cfg["youtube"]["require-direct-playlist-url"] = true
+	data, err = extractor.Extract(context.Background(), cfg, vUrl)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if len(data) != 1 || data[0].PlaylistTitle != "" || data[0].Title != "Fixture Video" {
+		t.Fatalf("Expected only a single video but got %+v", data)
+	}
+}
@@ -0,0 +1,161 @@
+package youtube
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	"git.nobrain.org/r4/dischord/util"
+
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrMusicAlbumNotFound = errors.New("unable to find the YouTube Music album's playlist")
+)
+
+const (
+	musicBaseUrl = "https://music.youtube.com"
+	// Search filter for "Songs", as sent by the web app
+	musicSongsSearchParams = "EgWKAQIIAWoMEA4QChADEAQQCRAF"
+)
+
+type musicBrowseData struct {
+	Microformat struct {
+		MicroformatDataRenderer struct {
+			UrlCanonical string `json:"urlCanonical"` // the album's playlist
+		} `json:"microformatDataRenderer"`
+	} `json:"microformat"`
+}
+
+// Albums (music.youtube.com/browse/MPREb_...) are just regular playlists
+// with a different ID.
+func getMusicAlbumFunc(ctx context.Context, client *http.Client, aUrl string, fn func([]extractor.Data) error) error {
+	u, err := url.Parse(aUrl)
+	if err != nil {
+		return err
+	}
+	browseId := strings.TrimPrefix(u.Path, "/browse/")
+
+	var data musicBrowseData
+	if err := innertubePost(ctx, client, musicBaseUrl, musicClient, "browse", map[string]any{"browseId": browseId}, &data); err != nil {
+		return err
+	}
+	pu, err := url.Parse(data.Microformat.MicroformatDataRenderer.UrlCanonical)
+	if err != nil {
+		return ErrMusicAlbumNotFound
+	}
+	listId := pu.Query().Get("list")
+	if listId == "" {
+		return ErrMusicAlbumNotFound
+	}
+	return getPlaylistFunc(ctx, client, "https://www.youtube.com/playlist?list="+listId, 0, fn)
+}
+
+type musicRuns struct {
+	Runs []struct {
+		Text string `json:"text"`
+	} `json:"runs"`
+}
+
+func (r musicRuns) String() string {
+	var b strings.Builder
+	for _, v := range r.Runs {
+		b.WriteString(v.Text)
+	}
+	return b.String()
+}
+
+type musicSearchData struct {
+	Contents struct {
+		TabbedSearchResultsRenderer struct {
+			Tabs []struct {
+				TabRenderer struct {
+					Content struct {
+						SectionListRenderer struct {
+							Contents []struct {
+								MusicShelfRenderer struct {
+									Contents []struct {
+										MusicResponsiveListItemRenderer struct {
+											FlexColumns []struct {
+												MusicResponsiveListItemFlexColumnRenderer struct {
+													Text musicRuns `json:"text"`
+												} `json:"musicResponsiveListItemFlexColumnRenderer"`
+											} `json:"flexColumns"`
+											PlaylistItemData struct {
+												VideoId string `json:"videoId"`
+											} `json:"playlistItemData"`
+										} `json:"musicResponsiveListItemRenderer"`
+									} `json:"contents"`
+								} `json:"musicShelfRenderer"`
+							} `json:"contents"`
+						} `json:"sectionListRenderer"`
+					} `json:"content"`
+				} `json:"tabRenderer"`
+			} `json:"tabs"`
+		} `json:"tabbedSearchResultsRenderer"`
+	} `json:"contents"`
+}
+
+// Only returns songs (no music videos, user uploads etc.). Only gets
+// superficial data, the actual stream URL must be extracted from SourceUrl.
+func getMusicSearch(ctx context.Context, client *http.Client, query string) ([]extractor.Data, error) {
+	var data musicSearchData
+	body := map[string]any{
+		"query":  query,
+		"params": musicSongsSearchParams,
+	}
+	if err := innertubePost(ctx, client, musicBaseUrl, musicClient, "search", body, &data); err != nil {
+		return nil, err
+	}
+
+	var res []extractor.Data
+	for _, tab := range data.Contents.TabbedSearchResultsRenderer.Tabs {
+		for _, section := range tab.TabRenderer.Content.SectionListRenderer.Contents {
+			for _, item := range section.MusicShelfRenderer.Contents {
+				v := item.MusicResponsiveListItemRenderer
+				if v.PlaylistItemData.VideoId == "" {
+					continue
+				}
+				if len(v.FlexColumns) < 2 {
+					return nil, ErrMalformedJson
+				}
+				title := v.FlexColumns[0].MusicResponsiveListItemFlexColumnRenderer.Text.String()
+
+				// e.g. "Infected Mushroom & Ninet Tayeb • Head of NASA and the 2 Amish Boys • 4:20"
+				details := strings.Split(v.FlexColumns[1].MusicResponsiveListItemFlexColumnRenderer.Text.String(), " • ")
+				if details[0] == "Song" {
+					details = details[1:]
+				}
+				if len(details) == 0 {
+					return nil, ErrMalformedJson
+				}
+				length, err := util.ParseDurationSeconds(details[len(details)-1])
+				if err != nil {
+					length = -1
+				}
+
+				album := ""
+				if len(details) == 3 {
+					album = details[1]
+				}
+
+				res = append(res, extractor.Data{
+					SourceUrl: "https://www.youtube.com/watch?v=" + v.PlaylistItemData.VideoId,
+					Title:     title,
+					Uploader:  details[0],
+					Artist:    details[0],
+					Album:     album,
+					Thumbnail: thumbnailUrl(v.PlaylistItemData.VideoId),
+					Duration:  length,
+					// Songs are only uploaded by the artists (or their labels)
+					OfficialArtist: true,
+					Source:         "YouTube Music",
+				})
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -3,6 +3,7 @@ package ytdl
 import (
 	"git.nobrain.org/r4/dischord/extractor"
 
+	"context"
 	"strings"
 )
 
@@ -15,6 +16,9 @@ type Extractor struct{}
 func (e *Extractor) DefaultConfig() extractor.ProviderConfig {
 	return extractor.ProviderConfig{
 		"youtube-dl-path": "yt-dlp",
+		// Matches any URL, so it should only be used if nothing else can
+		// handle the URL (or as a fallback if the other provider fails)
+		"priority": int64(-10),
 	}
 }
 
@@ -22,14 +26,42 @@ func (e *Extractor) Matches(cfg extractor.ProviderConfig, input string) bool {
 	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
 }
 
-func (e *Extractor) Extract(cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
+func (e *Extractor) Extract(ctx context.Context, cfg extractor.ProviderConfig, input string) ([]extractor.Data, error) {
 	var res []extractor.Data
-	dch, errch := ytdlGet(cfg["youtube-dl-path"].(string), input)
-	for v := range dch {
-		res = append(res, v)
-	}
-	for err := range errch {
+	err := e.ExtractFunc(ctx, cfg, input, func(data []extractor.Data) error {
+		res = append(res, data...)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	return res, nil
 }
+
+// youtube-dl outputs one video at a time, each of which is passed on as soon
+// as it's there.
+func (e *Extractor) ExtractFunc(ctx context.Context, cfg extractor.ProviderConfig, input string, fn func([]extractor.Data) error) error {
+	// Kills youtube-dl if fn fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var fnErr error
+	mch, errch := ytdlGet(ctx, cfg["youtube-dl-path"].(string), extractor.HttpSettings(cfg), input)
+	for m := range mch {
+		if fnErr != nil {
+			// Drain the channel until youtube-dl is dead
+			continue
+		}
+		if d, ok := m.audioData(); ok {
+			if fnErr = fn([]extractor.Data{d}); fnErr != nil {
+				cancel()
+			}
+		}
+	}
+	for err := range errch {
+		if fnErr == nil {
+			return err
+		}
+	}
+	return fnErr
+}
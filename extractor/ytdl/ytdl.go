@@ -4,9 +4,11 @@ import (
 	"git.nobrain.org/r4/dischord/extractor"
 
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -24,17 +26,58 @@ type ytdlMetadata struct {
 	Playlist    string  `json:"playlist"`
 	Uploader    string  `json:"uploader"`
 	Description string  `json:"description"`
+	Thumbnail   string  `json:"thumbnail"`
+	Artist      string  `json:"artist"`
+	Album       string  `json:"album"`
+	ReleaseYear int     `json:"release_year"`
+	UploadDate  string  `json:"upload_date"` // e.g. "20100504"
+	ViewCount   int64   `json:"view_count"`
+	IsLive      bool    `json:"is_live"`
 	Formats     []struct {
 		Url    string `json:"url"`
-		Format string `json"format"`
+		Format string `json:"format"`
 		VCodec string `json:"vcodec"`
 	} `json:"formats"`
 }
 
-// Gradually sends all audio URLs through the string channel. If an error occurs, it is sent through the
-// error channel. Both channels are closed after either an error occurs or all URLs have been output.
-func ytdlGet(youtubeDLPath, input string) (<-chan extractor.Data, <-chan error) {
-	out := make(chan extractor.Data)
+// Returns the data of the best audio-only format, if there is one.
+func (m ytdlMetadata) audioData() (extractor.Data, bool) {
+	year := m.ReleaseYear
+	if year == 0 && len(m.UploadDate) >= 4 {
+		year, _ = strconv.Atoi(m.UploadDate[:4])
+	}
+
+	// The latter formats are always the better with youtube-dl
+	for i := len(m.Formats) - 1; i >= 0; i-- {
+		format := m.Formats[i]
+		if format.VCodec == "none" {
+			return extractor.Data{
+				SourceUrl:     m.WebpageUrl,
+				StreamUrl:     format.Url,
+				Title:         m.Title,
+				PlaylistTitle: m.Playlist,
+				Description:   m.Description,
+				Uploader:      m.Uploader,
+				Artist:        m.Artist,
+				Album:         m.Album,
+				Year:          year,
+				Thumbnail:     m.Thumbnail,
+				Views:         m.ViewCount,
+				IsLive:        m.IsLive,
+				Duration:      int(m.Duration),
+				Expires:       time.Now().Add(10 * 365 * 24 * time.Hour),
+			}, true
+		}
+	}
+	return extractor.Data{}, false
+}
+
+// Gradually sends the metadata of all videos through the metadata channel. If an error occurs, it is sent
+// through the error channel. Both channels are closed after either an error occurs or all metadata has been
+// output. youtube-dl is killed once ctx is done. The HTTP settings are passed on to youtube-dl where
+// possible.
+func ytdlGet(ctx context.Context, youtubeDLPath string, httpSettings extractor.ProviderConfig, input string) (<-chan ytdlMetadata, <-chan error) {
+	out := make(chan ytdlMetadata)
 	errch := make(chan error, 1)
 
 	go func() {
@@ -43,10 +86,25 @@ func ytdlGet(youtubeDLPath, input string) (<-chan extractor.Data, <-chan error)
 
 		// Set youtube-dl args
 		var ytdlArgs []string
+		if v := httpSettings["proxy"].(string); v != "" {
+			ytdlArgs = append(ytdlArgs, "--proxy", v)
+		}
+		if v := httpSettings["user-agent"].(string); v != "" {
+			ytdlArgs = append(ytdlArgs, "--user-agent", v)
+		}
+		if v := httpSettings["cookie-file"].(string); v != "" {
+			ytdlArgs = append(ytdlArgs, "--cookies", v)
+		}
+		if v := httpSettings["timeout-seconds"].(int64); v != 0 {
+			ytdlArgs = append(ytdlArgs, "--socket-timeout", strconv.FormatInt(v, 10))
+		}
+		if v := httpSettings["retries"].(int64); v != 0 {
+			ytdlArgs = append(ytdlArgs, "--retries", strconv.FormatInt(v, 10))
+		}
 		ytdlArgs = append(ytdlArgs, "-j", input)
 
 		// Prepare command for execution
-		cmd := exec.Command(youtubeDLPath, ytdlArgs...)
+		cmd := exec.CommandContext(ctx, youtubeDLPath, ytdlArgs...)
 		cmd.Env = []string{"LC_ALL=en_US.UTF-8"} // Youtube-dl doesn't recognize some chars if LC_ALL=C or not set at all
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
@@ -79,46 +137,34 @@ func ytdlGet(youtubeDLPath, input string) (<-chan extractor.Data, <-chan error)
 			return
 		}
 
-		// We want to let our main loop know when youtube-dl is done
-		donech := make(chan error)
-		go func() {
-			donech <- cmd.Wait()
-		}()
-
 		// Main JSON decoder loop
 		dec := json.NewDecoder(stdout)
 		for dec.More() {
 			// Read JSON
 			var m ytdlMetadata
 			if err := dec.Decode(&m); err != nil {
+				cmd.Process.Kill()
+				<-stderrReadDoneCh
+				cmd.Wait()
+				if ctx.Err() != nil {
+					err = ctx.Err()
+				}
 				errch <- err
 				return
 			}
 
-			// Extract URL from metadata (the latter formats are always the better with youtube-dl)
-			for i := len(m.Formats) - 1; i >= 0; i-- {
-				format := m.Formats[i]
-				if format.VCodec == "none" {
-					out <- extractor.Data{
-						SourceUrl:     m.WebpageUrl,
-						StreamUrl:     format.Url,
-						Title:         m.Title,
-						PlaylistTitle: m.Playlist,
-						Description:   m.Description,
-						Uploader:      m.Uploader,
-						Duration:      int(m.Duration),
-						Expires:       time.Now().Add(10 * 365 * 24 * time.Hour),
-					}
-					break
-				}
-			}
+			out <- m
 		}
 
-		// Wait for command to finish executing and catch any errors
-		err = <-donech
+		// Wait for command to finish executing and catch any errors (Wait()
+		// closes the pipes, so it must not be called before they're read)
 		<-stderrReadDoneCh
+		err = cmd.Wait()
 		if err != nil {
-			if ytdlError == "" {
+			if ctx.Err() != nil {
+				// Killed because of the context
+				errch <- ctx.Err()
+			} else if ytdlError == "" {
 				errch <- err
 			} else {
 				if strings.HasPrefix(ytdlError, "Unsupported URL: ") {
@@ -0,0 +1,95 @@
+package ytdl_test
+
+import (
+	"git.nobrain.org/r4/dischord/extractor"
+	_ "git.nobrain.org/r4/dischord/extractor/builtins"
+	"git.nobrain.org/r4/dischord/extractor/internal/fixture"
+	"git.nobrain.org/r4/dischord/extractor/ytdl"
+
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"testing"
+)
+
+func TestFixtureYoutubeDl(t *testing.T) {
+	fixture.SkipWithoutShell(t)
+
+	cfg := fixture.Config(t)
+	data, err := extractor.Extract(context.Background(), cfg, "https://media.example.org/album/fixture-album")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	for i := range data {
+		fixture.CheckExpires(t, &data[i], 10*365*24*time.Hour)
+	}
+	fixture.CheckData(t, data, []extractor.Data{
+		{
+			SourceUrl:     "https://media.example.org/track/prelude",
+			StreamUrl:     "https://cf-media.example.com/prelude.opus",
+			Title:         "Prelude",
+			PlaylistTitle: "Fixture Album",
+			Uploader:      "Fixture Band",
+			Artist:        "Fixture Band",
+			Album:         "Fixture Album",
+			Year:          2019,
+			Thumbnail:     "https://media.example.org/art/fixture-album.jpg",
+			Views:         1234,
+			Duration:      125,
+		},
+		{
+			SourceUrl:     "https://media.example.org/track/slam",
+			StreamUrl:     "https://cf-media.example.com/slam.opus",
+			Title:         "Slam",
+			PlaylistTitle: "Fixture Album",
+			Description:   "Second track",
+			Uploader:      "Fixture Band",
+			Year:          2020, // from the upload date
+			Thumbnail:     "https://media.example.org/art/fixture-album.jpg",
+			Duration:      251,
+		},
+	})
+
+	// Tracks are passed on one by one
+	calls := 0
+	err = extractor.ExtractFunc(context.Background(), cfg, "https://media.example.org/album/fixture-album", func(data []extractor.Data) error {
+		calls++
+		if len(data) != 1 {
+			t.Errorf("Expected a single track but got %+v", data)
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Fatalf("Expected no error after 2 calls but got '%v' after %v", err, calls)
+	}
+
+	// The HTTP settings are passed on
+	cfg[extractor.HttpConfigName]["proxy"] = "socks5://localhost:1080"
+	data, err = extractor.Extract(context.Background(), cfg, "https://example.com/args")
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	expectedArgs := "--proxy socks5://localhost:1080 --socket-timeout 30 --retries 2 -j https://example.com/args"
+	if len(data) != 1 || data[0].Title != expectedArgs {
+		t.Fatalf("Expected youtube-dl arguments '%v' but got %+v", expectedArgs, data)
+	}
+
+	_, err = extractor.Extract(context.Background(), cfg, "https://example.com/unsupported")
+	if !errors.Is(err, ytdl.ErrUnsupportedUrl) {
+		t.Fatalf("Expected error '%v' but got '%v'", ytdl.ErrUnsupportedUrl, err)
+	}
+
+	_, err = extractor.Extract(context.Background(), cfg, "https://example.com/missing")
+	if err == nil || !strings.HasSuffix(err.Error(), "ytdl: Unable to download webpage: HTTP Error 404: Not Found") {
+		t.Fatalf("Expected youtube-dl's error message but got '%v'", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = extractor.Extract(ctx, cfg, "https://example.com/hang")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected error '%v' but got '%v'", context.DeadlineExceeded, err)
+	}
+}
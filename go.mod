@@ -1,16 +1,21 @@
 module git.nobrain.org/r4/dischord
 
-go 1.18
+go 1.20
 
 require (
 	github.com/BurntSushi/toml v1.2.0
 	github.com/bwmarrin/discordgo v0.27.1
+	github.com/dop251/goja v0.0.0-20241024094426-79f3a7efcdbd
 	github.com/ulikunitz/xz v0.5.10
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
 )
 
 require (
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
 	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-	golang.org/x/sys v0.0.0-20201119102817-f84b799fce68 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -5,6 +5,7 @@ import (
 	"git.nobrain.org/r4/dischord/extractor"
 
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -12,6 +13,9 @@ import (
 	"time"
 )
 
+// Time limit for refreshing a track's stream URL.
+const extractTimeout = 30 * time.Second
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -79,12 +83,14 @@ type CmdSwap struct{ A, B int }
 type CmdDelete []int
 type CmdAddFront []extractor.Data
 type CmdAddBack []extractor.Data
-type CmdSeek float64  // seconds
-type CmdSpeed float64 // speed factor
+type CmdSeek float64        // seconds
+type CmdSpeed float64       // speed factor
+type CmdReloadStream string // SourceUrl of the tracks whose streams should be extracted again (e.g. after a wrong match was fixed)
 type CmdPlayFileAndStop struct {
 	DoneCh chan<- struct{}
 	Data   []byte
 }
+type CmdSetTap func(frame []byte) // called with every frame sent to outCh from the client's goroutine; nil removes the tap
 type CmdGetTime chan<- float64
 type CmdGetQueue chan<- *Queue
 type CmdGetSpeed chan<- float64
@@ -154,6 +160,8 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 
 		var filePlaybackDoneCh chan<- struct{}
 
+		var tap func(frame []byte)
+
 		// Mostly notes to self:
 		// This entire setup is pretty fragile, so I'll try to explain it:
 		// Each stream consists of the three fundamental channels below.
@@ -225,7 +233,9 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 					var data []extractor.Data
 					var err error
 					for {
-						data, err = extractor.Extract(excfg, queue.Playing.SourceUrl)
+						ctx, cancel := context.WithTimeout(context.Background(), extractTimeout)
+						data, err = extractor.Extract(ctx, excfg, queue.Playing.SourceUrl)
+						cancel()
 						if err == nil {
 							break
 						} else {
@@ -243,7 +253,11 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 					}
 					if err == nil {
 						if len(data) == 1 {
+							// The start offset may come from a URL other than
+							// the SourceUrl (e.g. a playlist link)
+							startOffset := queue.Playing.StartOffset
 							*queue.Playing = data[0]
+							queue.Playing.StartOffset = startOffset
 						} else {
 							cErrCh <- errors.New("got invalid data refreshing stream")
 						}
@@ -251,7 +265,7 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 				}
 
 				// Get new stream
-				audioch, errch, killch = audio.StreamToDiscordOpus(ffmpegPath, queue.Playing.StreamUrl, nil, seek, speed, true)
+				audioch, errch, killch = audio.StreamToDiscordOpus(ffmpegPath, queue.Playing.StreamUrl, excfg.HttpProxy(), nil, seek, speed, true)
 
 				// Reset stream info
 				nFrames = 0
@@ -264,6 +278,14 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 			}
 		}
 
+		// Where a track that is just starting to play should begin
+		getStartTime := func() float64 {
+			if queue.Playing == nil {
+				return 0
+			}
+			return float64(queue.Playing.StartOffset)
+		}
+
 		// Queue overflow safe
 		jumpTracks = func(nRel int) {
 			// Kill the potential current stream
@@ -335,7 +357,7 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 			}
 
 			// Update stream
-			refreshStream(0, playbackSpeed)
+			refreshStream(getStartTime(), playbackSpeed)
 		}
 
 		var unshuffle func()
@@ -371,6 +393,9 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 			case frame, ok := <-readAudioCh():
 				if ok {
 					outCh <- frame
+					if tap != nil {
+						tap(frame)
+					}
 					nFrames++
 				} else {
 					// Audio channel was closed -> stream is finished -> reset all stream channels
@@ -461,7 +486,7 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 							}
 							*queue.At(sw.A), *queue.At(sw.B) = *queue.At(sw.B), *queue.At(sw.A)
 							if replacePlaying {
-								refreshStream(0, playbackSpeed)
+								refreshStream(getStartTime(), playbackSpeed)
 							}
 						}
 					case CmdDelete:
@@ -520,13 +545,26 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 						}
 					case CmdSpeed:
 						refreshStream(getPlaybackTime(), float64(v))
+					case CmdReloadStream:
+						// Queued tracks get their new stream once they're played
+						for _, q := range [][]extractor.Data{queue.Done, queue.Ahead, queue.AheadUnshuffled} {
+							for i := range q {
+								if q[i].SourceUrl == string(v) {
+									q[i].StreamUrl = ""
+								}
+							}
+						}
+						if queue.Playing != nil && queue.Playing.SourceUrl == string(v) {
+							queue.Playing.StreamUrl = ""
+							refreshStream(getPlaybackTime(), playbackSpeed)
+						}
 					case CmdPlayFileAndStop:
 						cmd := struct {
 							DoneCh chan<- struct{}
 							Data   []byte
 						}(v)
 
-						audioch, errch, killch = audio.StreamToDiscordOpus(ffmpegPath, "pipe:", bytes.NewReader(cmd.Data), 0, 1.0, false)
+						audioch, errch, killch = audio.StreamToDiscordOpus(ffmpegPath, "pipe:", "", bytes.NewReader(cmd.Data), 0, 1.0, false)
 
 						// Reset stream info
 						nFrames = 0
@@ -537,6 +575,8 @@ func NewClient(excfg extractor.Config, ffmpegPath string, outCh chan<- []byte, c
 						queue.Loop = false
 
 						filePlaybackDoneCh = cmd.DoneCh
+					case CmdSetTap:
+						tap = v
 					case CmdGetTime:
 						v <- getPlaybackTime()
 					case CmdGetQueue:
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"strconv"
 	"strings"
 )
 
@@ -11,6 +12,23 @@ func CapitalizeFirst(s string) string {
 	return strings.ToUpper(s[:1]) + s[1:]
 }
 
+// Formats n with thousands separators, e.g. "1,234,567".
+func FormatCount(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var res strings.Builder
+	for i, c := range s {
+		if i != 0 && (len(s)-i)%3 == 0 {
+			res.WriteByte(',')
+		}
+		res.WriteRune(c)
+	}
+	return sign + res.String()
+}
+
 // A StringTabulator aligns columns similarly to the tabulator
 // character (but 100% rigorously).
 type StringTabulator [][]string
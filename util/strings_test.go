@@ -0,0 +1,25 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestFormatCount(t *testing.T) {
+	for _, test := range []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{123456, "123,456"},
+		{1234567, "1,234,567"},
+		{-1234, "-1,234"},
+		{-999, "-999"},
+		{9223372036854775807, "9,223,372,036,854,775,807"},
+	} {
+		if res := FormatCount(test.input); res != test.expected {
+			t.Errorf("%v: expected %q but got %q", test.input, test.expected, res)
+		}
+	}
+}